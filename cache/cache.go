@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/dperique/release-analysis/fetch"
+	"github.com/spf13/cobra"
+)
+
+type cacheOptsType struct {
+	maxSizeMB int64
+	all       bool
+}
+
+var cacheOpts cacheOptsType
+
+// Dir is the cache directory; it's set by the root command's --cache-dir flag.
+var Dir string
+
+// Create the cache command
+var CacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the on-disk cache of downloaded CI artifacts",
+	Long:  `Finished prow job artifacts never change so they are cached (in ~/.cache/release-analysis by default) and not downloaded again`,
+}
+
+// Create the cache prune command
+var CachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove expired entries and the least recently used ones until the cache fits in --max-size",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cacheOpts.Run()
+	},
+}
+
+func NewCacheCmd() *cobra.Command {
+	CachePruneCmd.Flags().Int64Var(&cacheOpts.maxSizeMB, "max-size", fetch.DefaultMaxCacheSize>>20, "Maximum size of the cache in MB")
+	CachePruneCmd.Flags().BoolVar(&cacheOpts.all, "all", false, "Remove everything in the cache")
+	CacheCmd.AddCommand(CachePruneCmd)
+	return CacheCmd
+}
+
+func (c *cacheOptsType) Run() {
+	cache, err := fetch.NewCache(Dir)
+	if err != nil {
+		slog.Error("unable to open the cache", "dir", Dir, "err", err)
+		return
+	}
+	before, err := cache.Size()
+	if err != nil {
+		slog.Error("unable to read the cache", "dir", Dir, "err", err)
+		return
+	}
+	maxSize := c.maxSizeMB << 20
+	if c.all {
+		maxSize = 0
+	}
+	after, err := cache.Prune(maxSize)
+	if err != nil {
+		slog.Error("unable to prune the cache", "dir", Dir, "err", err)
+		return
+	}
+	fmt.Printf("%s: %d MB -> %d MB\n", Dir, before>>20, after>>20)
+}
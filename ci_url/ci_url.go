@@ -0,0 +1,255 @@
+// Package ci_url turns the urls people paste (prow/spyglass pages, gcsweb directories, gs:// paths,
+// release controller payload pages, payload test run pages and sippy pages) into a JobRef so
+// nothing else has to take urls apart.
+package ci_url
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	ProwPrefix   = "https://prow.ci.openshift.org"
+	GcsWebPrefix = "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com"
+
+	// The hosts of sippy, the /payload run pages and (after the architecture) the release
+	// controllers; their paths are too generic to be taken apart on any other host.
+	SippyHost             = "sippy.dptools.openshift.org"
+	PayloadTestsHost      = "pr-payload-tests.ci.openshift.org"
+	ReleaseControllerHost = "ocp.releases.ci.openshift.org"
+
+	// DefaultBucket is where prow puts job runs now; it's used when a url (e.g., sippy's) doesn't
+	// say which bucket.
+	DefaultBucket = "test-platform-results"
+)
+
+// Kind is what a JobRef refers to.
+type Kind string
+
+const (
+	KindJob        Kind = "job"         // a prow job run
+	KindAggregated Kind = "aggregated"  // an aggregated job run (its job runs are other jobs)
+	KindPayload    Kind = "payload"     // a release payload
+	KindPayloadRun Kind = "payload-run" // a /payload run on a PR (its jobs are on the run page)
+)
+
+// JobRef is a job run or payload.  Version and Stream are empty when the job name doesn't say.
+type JobRef struct {
+	Kind    Kind
+	Bucket  string // e.g., test-platform-results or origin-ci-test
+	JobName string // e.g., periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn
+	BuildID string // e.g., 1781999912345678848
+	Version string // e.g., 4.16
+	Stream  string // nightly or ci
+
+	// Variant is the test the job runs, e.g., e2e-aws-ovn for ...-nightly-4.16-e2e-aws-ovn or
+	// aws-ovn-upgrade for aggregated-aws-ovn-upgrade-4.16-micro-release-...
+	Variant string
+
+	// Path is where the url pointed below the job run, e.g., artifacts/e2e-aws-ovn/gather-extra/.
+	Path string
+
+	// Org, Repo and PR are only set for presubmits (and /payload runs), which are under
+	// pr-logs/pull/<org>_<repo>/<pr>/ instead of logs/.
+	Org  string
+	Repo string
+	PR   string
+
+	// Payload and ReleaseUrl are only set for payloads, e.g., 4.16.0-0.nightly-2024-04-21-120000
+	// and its release controller page.
+	Payload    string
+	ReleaseUrl string
+
+	// RunUrl is only set for /payload runs; it's the page that lists the run's jobs.
+	RunUrl string
+}
+
+var (
+	buildIDRegex     = regexp.MustCompile(`^\d+$`)
+	jobVersionRegex  = regexp.MustCompile(`-(\d+\.\d+)(?:-|$)`)
+	jobStreamRegex   = regexp.MustCompile(`-(nightly|ci)-\d+\.\d+(?:-|$)`)
+	lastVersionRegex = regexp.MustCompile(`-\d+\.\d+-`)
+
+	// payloadRegex takes apart a payload tag, e.g., 4.16.0-0.nightly-arm64-2024-04-21-120000, into
+	// its release stream, version, stream and architecture.
+	payloadRegex = regexp.MustCompile(`^((\d+\.\d+)\.\d+-0\.(nightly|ci)(?:-(arm64|ppc64le|s390x|multi))?)-\d{4}-\d{2}-\d{2}-\d{6}$`)
+)
+
+// Resolve takes a url of a job run or payload and returns what it refers to.  These are understood:
+//
+//	https://prow.ci.openshift.org/view/gs/<bucket>/logs/<job>/<build id>
+//	https://prow.ci.openshift.org/view/gs/<bucket>/pr-logs/pull/<org>_<repo>/<pr>/<job>/<build id>
+//	https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/<bucket>/logs/<job>/<build id>/...
+//	gs://<bucket>/logs/<job>/<build id>/...
+//	https://<arch>.ocp.releases.ci.openshift.org/releasestream/<release stream>/release/<payload>
+//	https://sippy.dptools.openshift.org/sippy-ng/job_runs/<build id>/<job>/...
+//	https://sippy.dptools.openshift.org/sippy-ng/release/<version>/tags/<payload>
+//	https://pr-payload-tests.ci.openshift.org/runs/<stream>/<run id>
+//
+// The release controller, sippy and /payload run urls must be on those hosts; the prow and
+// gcsweb ones are taken by their path (so a mirror or a local gcsweb works too).
+func Resolve(rawUrl string) (JobRef, error) {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if gcsPath, found := strings.CutPrefix(rawUrl, "gs://"); found {
+		return resolveGcsPath(rawUrl, gcsPath)
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return JobRef{}, fmt.Errorf("%q is not a url", rawUrl)
+	}
+	parts := splitPath(u.Path)
+	host := u.Hostname()
+	releaseController := strings.HasSuffix(host, "."+ReleaseControllerHost)
+	switch {
+	case len(parts) > 2 && parts[0] == "view" && (parts[1] == "gs" || parts[1] == "gcs"):
+		// prow's spyglass page (the link in a payload or on prow's job list)
+		return resolveGcsPath(rawUrl, strings.Join(parts[2:], "/"))
+	case len(parts) > 1 && parts[0] == "gcs":
+		return resolveGcsPath(rawUrl, strings.Join(parts[1:], "/"))
+	case releaseController && len(parts) == 4 && parts[0] == "releasestream" && parts[2] == "release":
+		ref, err := resolvePayload(rawUrl, parts[3])
+		if err != nil {
+			// e.g., an rc or ec; the release controller page is all we need.
+			ref = JobRef{Kind: KindPayload, Payload: parts[3]}
+		}
+		ref.ReleaseUrl = rawUrl
+		return ref, nil
+	case host == SippyHost && len(parts) > 3 && parts[0] == "sippy-ng" && parts[1] == "job_runs":
+		if !buildIDRegex.MatchString(parts[2]) {
+			return JobRef{}, fmt.Errorf("%s: %q is not a build id", rawUrl, parts[2])
+		}
+		return jobRef(DefaultBucket, parts[3], parts[2], ""), nil
+	case host == SippyHost && len(parts) == 5 && parts[0] == "sippy-ng" && parts[1] == "release" && parts[3] == "tags":
+		return resolvePayload(rawUrl, parts[4])
+	case host == PayloadTestsHost && len(parts) == 3 && parts[0] == "runs":
+		if parts[1] != "nightly" && parts[1] != "ci" {
+			return JobRef{}, fmt.Errorf("%s: %q is not a nightly or ci stream", rawUrl, parts[1])
+		}
+		return JobRef{Kind: KindPayloadRun, Stream: parts[1], RunUrl: rawUrl}, nil
+	}
+	return JobRef{}, fmt.Errorf("%s: not a prow, gcsweb, release controller or sippy url of a job run or payload", rawUrl)
+}
+
+// splitPath splits a url path into its parts, ignoring empty ones (some urls have a "//").
+func splitPath(p string) []string {
+	return strings.FieldsFunc(p, func(c rune) bool { return c == '/' })
+}
+
+// resolveGcsPath takes the <bucket>/logs/<job>/<build id>/... (or
+// <bucket>/pr-logs/pull/<org>_<repo>/<pr>/<job>/<build id>/...) part of a url.
+func resolveGcsPath(rawUrl, gcsPath string) (JobRef, error) {
+	parts := splitPath(gcsPath)
+	if len(parts) > 2 && parts[1] == "pr-logs" && parts[2] == "pull" {
+		if len(parts) < 7 {
+			return JobRef{}, fmt.Errorf("%s: expected <bucket>/pr-logs/pull/<org>_<repo>/<pr>/<job>/<build id> in the path", rawUrl)
+		}
+		org, repo, found := strings.Cut(parts[3], "_")
+		if !found || !buildIDRegex.MatchString(parts[4]) {
+			return JobRef{}, fmt.Errorf("%s: %q is not <org>_<repo>/<pr>", rawUrl, parts[3]+"/"+parts[4])
+		}
+		if !buildIDRegex.MatchString(parts[6]) {
+			return JobRef{}, fmt.Errorf("%s: %q is not a build id", rawUrl, parts[6])
+		}
+		ref := jobRef(parts[0], parts[5], parts[6], strings.Join(parts[7:], "/"))
+		ref.Org, ref.Repo, ref.PR = org, repo, parts[4]
+		return ref, nil
+	}
+	if len(parts) < 4 || parts[1] != "logs" {
+		return JobRef{}, fmt.Errorf("%s: expected <bucket>/logs/<job>/<build id> in the path", rawUrl)
+	}
+	if !buildIDRegex.MatchString(parts[3]) {
+		return JobRef{}, fmt.Errorf("%s: %q is not a build id", rawUrl, parts[3])
+	}
+	return jobRef(parts[0], parts[2], parts[3], strings.Join(parts[4:], "/")), nil
+}
+
+// jobRef fills in what the job name says about the job.
+func jobRef(bucket, jobName, buildID, path string) JobRef {
+	ref := JobRef{Kind: KindJob, Bucket: bucket, JobName: jobName, BuildID: buildID, Path: path}
+	name, aggregated := strings.CutPrefix(jobName, "aggregated-")
+	if aggregated {
+		ref.Kind = KindAggregated
+		ref.Variant = name
+	}
+	if m := jobVersionRegex.FindStringSubmatchIndex(jobName); m != nil {
+		ref.Version = jobName[m[2]:m[3]]
+		if aggregated && m[0] > len("aggregated-") {
+			ref.Variant = jobName[len("aggregated-"):m[0]]
+		}
+	}
+	if m := jobStreamRegex.FindStringSubmatch(jobName); m != nil {
+		ref.Stream = m[1]
+	}
+	if strings.Contains(jobName, "-aggregator-periodic-") {
+		// A /payload run aggregates a periodic, e.g., openshift-origin-28000-aggregator-periodic-ci-...-4.16-e2e-aws-ovn-upgrade
+		ref.Kind = KindAggregated
+	}
+	if !aggregated {
+		// After the last version in case it's an upgrade, e.g., ...-ci-4.16-upgrade-from-stable-4.15-e2e-aws-ovn-upgrade
+		if all := lastVersionRegex.FindAllStringIndex(jobName, -1); all != nil {
+			ref.Variant = jobName[all[len(all)-1][1]:]
+		}
+	}
+	return ref
+}
+
+// resolvePayload takes a payload tag, e.g., 4.16.0-0.nightly-2024-04-21-120000.
+func resolvePayload(rawUrl, tag string) (JobRef, error) {
+	m := payloadRegex.FindStringSubmatch(tag)
+	if m == nil {
+		return JobRef{}, fmt.Errorf("%s: %q is not a nightly or ci payload", rawUrl, tag)
+	}
+	arch := m[4]
+	if arch == "" {
+		arch = "amd64"
+	}
+	return JobRef{
+		Kind:       KindPayload,
+		Version:    m[2],
+		Stream:     m[3],
+		Payload:    tag,
+		ReleaseUrl: fmt.Sprintf("https://%s.ocp.releases.ci.openshift.org/releasestream/%s/release/%s", arch, m[1], tag),
+	}, nil
+}
+
+// GcsPath returns where the job run is in its bucket, e.g., logs/<job>/<build id>.
+func (r JobRef) GcsPath() string {
+	if r.PR != "" {
+		return fmt.Sprintf("pr-logs/pull/%s_%s/%s/%s/%s", r.Org, r.Repo, r.PR, r.JobName, r.BuildID)
+	}
+	return fmt.Sprintf("logs/%s/%s", r.JobName, r.BuildID)
+}
+
+// ProwUrl returns the prow page of the job run.
+func (r JobRef) ProwUrl() string {
+	return fmt.Sprintf("%s/view/gs/%s/%s", ProwPrefix, r.Bucket, r.GcsPath())
+}
+
+// GcsWebUrl returns the gcsweb directory of the job run's artifacts.
+func (r JobRef) GcsWebUrl() string {
+	return fmt.Sprintf("%s/gcs/%s/%s", GcsWebPrefix, r.Bucket, r.GcsPath())
+}
+
+// JobHistoryUrl returns prow's page with the recent runs of a job (presubmits, whose names start
+// with pull-, are under pr-logs).
+func JobHistoryUrl(bucket, jobName string) string {
+	if strings.HasPrefix(jobName, "pull-") {
+		return fmt.Sprintf("%s/job-history/gs/%s/pr-logs/directory/%s", ProwPrefix, bucket, jobName)
+	}
+	return fmt.Sprintf("%s/job-history/gs/%s/logs/%s", ProwPrefix, bucket, jobName)
+}
+
+// Url returns the url the rest of the tool uses for it: the prow page of a job run, the release
+// controller page of a payload or the page of a /payload run.
+func (r JobRef) Url() string {
+	switch r.Kind {
+	case KindPayload:
+		return r.ReleaseUrl
+	case KindPayloadRun:
+		return r.RunUrl
+	}
+	return r.ProwUrl()
+}
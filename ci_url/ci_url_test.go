@@ -0,0 +1,132 @@
+package ci_url
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	const (
+		nightlyJob = "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn"
+		upgradeJob = "periodic-ci-openshift-release-master-ci-4.16-upgrade-from-stable-4.15-e2e-aws-ovn-upgrade"
+		aggrJob    = "aggregated-aws-ovn-upgrade-4.16-micro-release-openshift-release-analysis-aggregator"
+		buildID    = "1782000000000000301"
+		payload    = "4.16.0-0.nightly-2024-04-21-120000"
+		releaseUrl = "https://amd64.ocp.releases.ci.openshift.org/releasestream/4.16.0-0.nightly/release/" + payload
+	)
+	nightly := JobRef{Kind: KindJob, Bucket: DefaultBucket, JobName: nightlyJob, BuildID: buildID, Version: "4.16", Stream: "nightly", Variant: "e2e-aws-ovn"}
+	withPath := func(ref JobRef, path string) JobRef {
+		ref.Path = path
+		return ref
+	}
+	onBucket := func(ref JobRef, bucket string) JobRef {
+		ref.Bucket = bucket
+		return ref
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want JobRef
+	}{
+		{"prow", ProwPrefix + "/view/gs/test-platform-results/logs/" + nightlyJob + "/" + buildID, nightly},
+		{"prow with spaces around it", "  " + ProwPrefix + "/view/gs/test-platform-results/logs/" + nightlyJob + "/" + buildID + "\n", nightly},
+		{"prow's gcs view", ProwPrefix + "/view/gcs/origin-ci-test/logs/" + nightlyJob + "/" + buildID, onBucket(nightly, "origin-ci-test")},
+		{"gcsweb", GcsWebPrefix + "/gcs/test-platform-results/logs/" + nightlyJob + "/" + buildID + "/", nightly},
+		{"gcsweb below the job run", GcsWebPrefix + "/gcs/test-platform-results/logs/" + nightlyJob + "/" + buildID + "/artifacts/e2e-aws-ovn/gather-extra/", withPath(nightly, "artifacts/e2e-aws-ovn/gather-extra")},
+		{"a // in the path", GcsWebPrefix + "/gcs/test-platform-results/logs//" + nightlyJob + "/" + buildID + "//artifacts//junit/", withPath(nightly, "artifacts/junit")},
+		{"gs://", "gs://test-platform-results/logs/" + nightlyJob + "/" + buildID + "/build-log.txt", withPath(nightly, "build-log.txt")},
+		{"presubmit", ProwPrefix + "/view/gs/test-platform-results/pr-logs/pull/openshift_origin/28000/pull-ci-openshift-origin-master-e2e-aws-ovn/" + buildID,
+			JobRef{Kind: KindJob, Bucket: DefaultBucket, JobName: "pull-ci-openshift-origin-master-e2e-aws-ovn", BuildID: buildID, Org: "openshift", Repo: "origin", PR: "28000"}},
+		{"/payload aggregator", "gs://test-platform-results/pr-logs/pull/openshift_origin/28000/openshift-origin-28000-aggregator-periodic-ci-openshift-release-master-ci-4.16-e2e-aws-ovn-upgrade/" + buildID,
+			JobRef{Kind: KindAggregated, Bucket: DefaultBucket, JobName: "openshift-origin-28000-aggregator-periodic-ci-openshift-release-master-ci-4.16-e2e-aws-ovn-upgrade", BuildID: buildID, Version: "4.16", Stream: "ci", Variant: "e2e-aws-ovn-upgrade", Org: "openshift", Repo: "origin", PR: "28000"}},
+		// The variant is after the last version and the version is the one being tested.
+		{"upgrade", ProwPrefix + "/view/gs/test-platform-results/logs/" + upgradeJob + "/" + buildID,
+			JobRef{Kind: KindJob, Bucket: DefaultBucket, JobName: upgradeJob, BuildID: buildID, Version: "4.16", Stream: "ci", Variant: "e2e-aws-ovn-upgrade"}},
+		{"aggregated", ProwPrefix + "/view/gs/test-platform-results/logs/" + aggrJob + "/" + buildID,
+			JobRef{Kind: KindAggregated, Bucket: DefaultBucket, JobName: aggrJob, BuildID: buildID, Version: "4.16", Variant: "aws-ovn-upgrade"}},
+		{"aggregated without a version", ProwPrefix + "/view/gs/test-platform-results/logs/aggregated-aws-ovn-upgrade-micro/" + buildID,
+			JobRef{Kind: KindAggregated, Bucket: DefaultBucket, JobName: "aggregated-aws-ovn-upgrade-micro", BuildID: buildID, Variant: "aws-ovn-upgrade-micro"}},
+		{"release controller", releaseUrl, JobRef{Kind: KindPayload, Version: "4.16", Stream: "nightly", Payload: payload, ReleaseUrl: releaseUrl}},
+		{"release controller for arm64", "https://arm64.ocp.releases.ci.openshift.org/releasestream/4.16.0-0.ci-arm64/release/4.16.0-0.ci-arm64-2024-04-21-120000",
+			JobRef{Kind: KindPayload, Version: "4.16", Stream: "ci", Payload: "4.16.0-0.ci-arm64-2024-04-21-120000", ReleaseUrl: "https://arm64.ocp.releases.ci.openshift.org/releasestream/4.16.0-0.ci-arm64/release/4.16.0-0.ci-arm64-2024-04-21-120000"}},
+		// An rc or ec isn't a nightly or ci payload; its page is all we have.
+		{"release controller rc", "https://amd64.ocp.releases.ci.openshift.org/releasestream/4-stable/release/4.16.0-rc.3",
+			JobRef{Kind: KindPayload, Payload: "4.16.0-rc.3", ReleaseUrl: "https://amd64.ocp.releases.ci.openshift.org/releasestream/4-stable/release/4.16.0-rc.3"}},
+		{"release controller ec", "https://amd64.ocp.releases.ci.openshift.org/releasestream/4-dev-preview/release/4.17.0-ec.1",
+			JobRef{Kind: KindPayload, Payload: "4.17.0-ec.1", ReleaseUrl: "https://amd64.ocp.releases.ci.openshift.org/releasestream/4-dev-preview/release/4.17.0-ec.1"}},
+		{"sippy job run", "https://" + SippyHost + "/sippy-ng/job_runs/" + buildID + "/" + nightlyJob + "/intervals", nightly},
+		{"sippy payload", "https://" + SippyHost + "/sippy-ng/release/4.16/tags/" + payload, JobRef{Kind: KindPayload, Version: "4.16", Stream: "nightly", Payload: payload, ReleaseUrl: releaseUrl}},
+		{"/payload run", "https://" + PayloadTestsHost + "/runs/ci/3a1b2c3d-0", JobRef{Kind: KindPayloadRun, Stream: "ci", RunUrl: "https://" + PayloadTestsHost + "/runs/ci/3a1b2c3d-0"}},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.url)
+		if err != nil {
+			t.Errorf("%s: Resolve(%q): %v", tt.name, tt.url, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Resolve(%q) =\n  %+v, want\n  %+v", tt.name, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	const job = "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn"
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"not a url", "is not a url"},
+		{"ftp://prow.ci.openshift.org/view/gs/test-platform-results/logs/" + job + "/1", "is not a url"},
+		{ProwPrefix + "/view/gs/test-platform-results/logs/" + job + "/latest", `"latest" is not a build id`},
+		{ProwPrefix + "/view/gs/test-platform-results/logs/" + job, "expected <bucket>/logs/<job>/<build id>"},
+		{"gs://test-platform-results/pr-logs/pull/openshift_origin/28000/pull-ci-openshift-origin-master-e2e-aws-ovn/abc", `"abc" is not a build id`},
+		{"gs://test-platform-results/pr-logs/pull/origin/28000/pull-ci-openshift-origin-master-e2e-aws-ovn/1", "is not <org>_<repo>/<pr>"},
+		{"https://" + SippyHost + "/sippy-ng/job_runs/abc/" + job, `"abc" is not a build id`},
+		{"https://" + SippyHost + "/sippy-ng/release/4.16/tags/4.16.0-rc.3", "is not a nightly or ci payload"},
+		{"https://" + PayloadTestsHost + "/runs/okd/3a1b2c3d-0", `"okd" is not a nightly or ci stream`},
+		// Those paths only mean something on their own hosts.
+		{"https://example.com/runs/ci/3a1b2c3d-0", "not a prow, gcsweb"},
+		{"https://example.com/sippy-ng/job_runs/1/" + job, "not a prow, gcsweb"},
+		{"https://example.com/releasestream/4.16.0-0.nightly/release/4.16.0-0.nightly-2024-04-21-120000", "not a prow, gcsweb"},
+		{"https://github.com/openshift/origin/pull/28000", "not a prow, gcsweb"},
+	}
+	for _, tt := range tests {
+		_, err := Resolve(tt.url)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Resolve(%q): expected an error with %q, got %v", tt.url, tt.want, err)
+		}
+	}
+}
+
+func TestUrls(t *testing.T) {
+	job := JobRef{Kind: KindJob, Bucket: "origin-ci-test", JobName: "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn", BuildID: "1"}
+	presubmit := JobRef{Kind: KindJob, Bucket: DefaultBucket, JobName: "pull-ci-openshift-origin-master-e2e-aws-ovn", BuildID: "2", Org: "openshift", Repo: "origin", PR: "28000"}
+	tests := []struct {
+		got, want string
+	}{
+		{job.GcsPath(), "logs/periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn/1"},
+		{job.ProwUrl(), ProwPrefix + "/view/gs/origin-ci-test/logs/periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn/1"},
+		{job.GcsWebUrl(), GcsWebPrefix + "/gcs/origin-ci-test/logs/periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn/1"},
+		{job.Url(), job.ProwUrl()},
+		{presubmit.GcsPath(), "pr-logs/pull/openshift_origin/28000/pull-ci-openshift-origin-master-e2e-aws-ovn/2"},
+		{presubmit.ProwUrl(), ProwPrefix + "/view/gs/test-platform-results/pr-logs/pull/openshift_origin/28000/pull-ci-openshift-origin-master-e2e-aws-ovn/2"},
+		{JobRef{Kind: KindPayload, ReleaseUrl: "release"}.Url(), "release"},
+		{JobRef{Kind: KindPayloadRun, RunUrl: "run"}.Url(), "run"},
+		{JobHistoryUrl("origin-ci-test", job.JobName), ProwPrefix + "/job-history/gs/origin-ci-test/logs/" + job.JobName},
+		{JobHistoryUrl(DefaultBucket, presubmit.JobName), ProwPrefix + "/job-history/gs/test-platform-results/pr-logs/directory/" + presubmit.JobName},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %s, want %s", tt.got, tt.want)
+		}
+	}
+
+	// A resolved url gives back the same url.
+	for _, url := range []string{job.ProwUrl(), presubmit.ProwUrl()} {
+		if ref, err := Resolve(url); err != nil || ref.ProwUrl() != url {
+			t.Errorf("expected %s to resolve to itself, got %s, %v", url, ref.ProwUrl(), err)
+		}
+	}
+}
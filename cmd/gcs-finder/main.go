@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"github.com/dperique/release-analysis/ci_url"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
@@ -19,8 +20,6 @@ const (
 	colorReset = "\033[0m"
 	lightGreen = "\033[92m"
 	yellow     = "\033[33m"
-
-	prowGCSBucket = "test-platform-results"
 )
 
 // TIP: use this in a VScode terminal and the links, produced by --showUrls, are clickable.
@@ -35,7 +34,7 @@ func main() {
 	// doesn't load and all we care about is the Artifacts link (and having a jobName and jobID
 	// is enough to craft the Artifacts path).
 
-	inputPath := flag.String("path", "", "Artifacts path from the prowJob's Artifacts link")
+	inputPath := flag.String("path", "", "Artifacts path from the prowJob's Artifacts link (or the prow, gs:// or sippy url of the job run)")
 
 	inputJobName := flag.String("jobName", "", "Job name")
 	inputJobID := flag.String("jobID", "", "Job ID")
@@ -63,9 +62,6 @@ func main() {
 		if *inputJobName == "" || *inputJobID == "" {
 			log.Fatal("Please provide a job name and job ID using -jobName and -jobID flags")
 		}
-
-		// Craft an inputPath from the jobName and jobID
-		*inputPath = fmt.Sprintf("https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/%s/%s", *inputJobName, *inputJobID)
 	}
 	if *inputRegex == "" {
 		log.Fatal("Please provide a regex using -regex flag")
@@ -86,24 +82,22 @@ func main() {
 		log.Fatalf("Invalid regex: %v", err)
 	}
 
-	// Take the input path and remove https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/ prefix
-	jobPath := strings.TrimPrefix(*inputPath, "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/")
-
-	// Extract the jobName and jobID from the path
-	var jobName, jobID string
+	// Get the bucket, jobName and jobID
+	var job ci_url.JobRef
 	if *inputJobName != "" && *inputJobID != "" {
-		// If we got here, the user passed in a jobName and jobID
-		jobName = *inputJobName
-		jobID = *inputJobID
+		// If we got here, the user passed in a jobName and jobID (which are in the current bucket)
+		job = ci_url.JobRef{Bucket: ci_url.DefaultBucket, JobName: *inputJobName, BuildID: *inputJobID}
 	} else {
 		// If we got here, the user passed in a path
-		parts := strings.Split(jobPath, "/")
-		if len(parts) != 3 {
-			log.Fatalf("Invalid path: %s", jobPath)
+		job, err = ci_url.Resolve(*inputPath)
+		if err != nil {
+			log.Fatalf("Invalid path: %v", err)
+		}
+		if job.JobName == "" {
+			log.Fatalf("Invalid path: %s is not a job run", *inputPath)
 		}
-		jobName = parts[0]
-		jobID = parts[1]
 	}
+	jobPath := job.GcsPath() + "/"
 
 	// Initialize GCS client and authenticate
 	ctx := context.Background()
@@ -115,8 +109,8 @@ func main() {
 
 	// Set up the query to list files in the specified path.  The Prefix needs to look
 	// like this so you can start from the root of artifacts for the prowJob:
-	// "logs/periodic-ci-openshift-release-master-ci-4.16-upgrade-from-stable-4.15-e2e-gcp-ovn-rt-upgrade/1737738676454035456"
-	query := &storage.Query{Prefix: "logs/" + jobPath}
+	// "logs/periodic-ci-openshift-release-master-ci-4.16-upgrade-from-stable-4.15-e2e-gcp-ovn-rt-upgrade/1737738676454035456/"
+	query := &storage.Query{Prefix: jobPath}
 
 	// Only retrieve the name and size to make the searches fast as we don't
 	// care about the contents.
@@ -124,7 +118,7 @@ func main() {
 		log.Fatalf("Failed to set attribute selection: %v", err)
 	}
 
-	bucketHandle := client.Bucket(prowGCSBucket)
+	bucketHandle := client.Bucket(job.Bucket)
 	it := bucketHandle.Objects(ctx, query)
 
 	// Iterate through the objects in the GCS bucket
@@ -140,7 +134,7 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to list objects: %v", err)
 		}
-		name := strings.TrimPrefix(attrs.Name, "logs/"+jobName+"/"+jobID+"/")
+		name := strings.TrimPrefix(attrs.Name, jobPath)
 
 		match := regex.FindString(attrs.Name)
 		if match != "" {
@@ -153,12 +147,12 @@ func main() {
 
 			if inputShowUrls != nil && *inputShowUrls {
 				// Craft the full URL of the file we found
-				fullURL := fmt.Sprintf("%10s %shttps://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/%s/%s/%s%s", " ", lightGreen, jobName, jobID, name, colorReset)
+				fullURL := fmt.Sprintf("%10s %s%s/%s%s", " ", lightGreen, job.GcsWebUrl(), name, colorReset)
 
 				// Get the dirName by trimming starting from the last slash
 				dirName := name[:strings.LastIndex(name, "/")]
 
-				dirURL := fmt.Sprintf("%10s %shttps://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/%s/%s/%s%s", " ", yellow, jobName, jobID, dirName, colorReset)
+				dirURL := fmt.Sprintf("%10s %s%s/%s%s", " ", yellow, job.GcsWebUrl(), dirName, colorReset)
 				fmt.Printf("  %s\n", fullURL)
 				fmt.Printf("  %s\n", dirURL)
 			}
@@ -3,14 +3,18 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/dperique/release-analysis/ci_url"
+	"github.com/dperique/release-analysis/fetch"
 )
 
 // This program downloads and unzips the logs from a link to a GCS bucket.
@@ -20,16 +24,15 @@ import (
 // because when you need to search node logs to troubleshoot an openshift
 // problem, there are a lot of logs to download.
 
+// downloadTimeout is for each attempt of a download; node journals can be big.
+const downloadTimeout = 5 * time.Minute
+
 // getBody takes a url, and returns the body (i.e., contents).
 // This is the same thing you get when you do curl -sk url.
-// Any error is fatal.
+// Any error (including a non-200 response) is fatal.
 func getBody(url string) []byte {
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	body, err := io.ReadAll(resp.Body)
-	checkErr((err))
+	body, err := fetch.Get(context.Background(), url, downloadTimeout)
+	checkErr(err)
 	return body
 }
 
@@ -40,8 +43,24 @@ func checkErr(err error) {
 	}
 }
 
+// gcsWebDir takes the url (gcsweb, prow or gs://) of a directory in the artifacts of a job run and
+// returns its gcsweb url and the bucket it's in.
+func gcsWebDir(url string) (string, string) {
+	job, err := ci_url.Resolve(url)
+	checkErr(err)
+	if job.JobName == "" {
+		log.Fatalf("%s is not in the artifacts of a job run", url)
+	}
+	dirUrl := job.GcsWebUrl() + "/"
+	if job.Path != "" {
+		dirUrl += job.Path + "/"
+	}
+	return dirUrl, job.Bucket
+}
+
 func processNode(url string) {
-	body := getBody(url)
+	dirUrl, bucket := gcsWebDir(url)
+	body := getBody(dirUrl)
 	nodesDirList := strings.Split(string(body), "\n")
 
 	regExp1 := regexp.MustCompile(`^.*<a href=\"`)
@@ -50,8 +69,8 @@ func processNode(url string) {
 	w := sync.WaitGroup{}
 	for _, i := range nodesDirList {
 		// gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/
-		if strings.Contains(i, "gcs/test-platform-results") && strings.Contains(i, "nodes") {
-			line := regExp1.ReplaceAllString(i, "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com")
+		if strings.Contains(i, "gcs/"+bucket) && strings.Contains(i, "nodes") {
+			line := regExp1.ReplaceAllString(i, ci_url.GcsWebPrefix)
 			line = regExp2.ReplaceAllString(line, "")
 			lineParts := strings.Split(line, "/")
 			nodeName := lineParts[len(lineParts)-2]
@@ -97,7 +116,8 @@ func processNode(url string) {
 }
 
 func processJunit(url, pattern string) {
-	body := getBody(url)
+	dirUrl, bucket := gcsWebDir(url)
+	body := getBody(dirUrl)
 	fileList := strings.Split(string(body), "\n")
 
 	regExp1 := regexp.MustCompile(`^.*<a href=\"`)
@@ -107,8 +127,8 @@ func processJunit(url, pattern string) {
 
 	count := 0
 	for _, i := range fileList {
-		if strings.Contains(i, "gcs/test-platform-results") {
-			line := regExp1.ReplaceAllString(i, "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com")
+		if strings.Contains(i, "gcs/"+bucket) {
+			line := regExp1.ReplaceAllString(i, ci_url.GcsWebPrefix)
 			line = regExp2.ReplaceAllString(line, "")
 			lineParts := strings.Split(line, "/")
 			fileName := lineParts[len(lineParts)-1]
@@ -143,7 +163,7 @@ func main() {
 	if len(os.Args) < 3 {
 		fmt.Printf("Usage: %s aMode aUrl aJUnitRegExPattern\n", os.Args[0])
 		fmt.Println("  mode = node or junit")
-		fmt.Println("  url = the relevant url (gather-extra/artifacts/nodes or e2e/e2e/artifacts/e2e/junit)")
+		fmt.Println("  url = the relevant gcsweb, prow or gs:// url (gather-extra/artifacts/nodes or e2e/e2e/artifacts/e2e/junit)")
 		os.Exit(0)
 	}
 	mode := os.Args[1]
@@ -0,0 +1,237 @@
+// Package config holds the user's defaults and tuning (timeouts, limits, output).  Each setting
+// comes from, in order of precedence: a flag, a RELEASE_ANALYSIS_* environment variable, the
+// config file (~/.config/release-analysis/config.yaml by default) or the built-in default.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dperique/release-analysis/logging"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to a setting's name (upper case, '-' replaced by '_') to get its
+// environment variable, e.g., RELEASE_ANALYSIS_BODY_TIMEOUT.
+const EnvPrefix = "RELEASE_ANALYSIS_"
+
+// Config is the effective value of every setting.
+type Config struct {
+	Version          string
+	Stream           string
+	DbMode           string
+	BodyTimeout      time.Duration
+	JunitTimeout     time.Duration
+	JobDetailTimeout time.Duration
+	MaxJobs          int
+	MaxTests         int
+	MaxChar          int
+	LogLevel         string
+	LogFormat        string
+	Color            string
+	Releases         string // version/stream pairs for serve, e.g., 4.16/nightly,4.17/ci
+}
+
+// Default returns the built-in settings.
+func Default() Config {
+	return Config{
+		Version:          "4.16",
+		Stream:           "nightly",
+		DbMode:           "rcWebpage",
+		BodyTimeout:      5 * time.Second,
+		JunitTimeout:     50 * time.Second,
+		JobDetailTimeout: 60 * time.Second,
+		MaxJobs:          10,
+		MaxTests:         20,
+		MaxChar:          175,
+		LogLevel:         logging.DefaultLevel,
+		LogFormat:        "text",
+		Color:            "auto",
+	}
+}
+
+// Current is set by Load; the commands read their defaults from it.
+var Current = Default()
+
+// Path is the config file; it's set by the root command's --config flag.
+var Path string
+
+// Sources says where each setting in Current came from ("default", "file", the environment
+// variable or "flag").
+var Sources = map[string]string{}
+
+// settings has one flag per setting (the name is also the key in the config file) bound to
+// Current.  The commands offer the ones that make sense for them (see Flag).
+var settings = pflag.NewFlagSet("config", pflag.ContinueOnError)
+
+func init() {
+	d := Default()
+	settings.StringVar(&Current.Version, "version", d.Version, "Default version for the payload command")
+	settings.StringVar(&Current.Stream, "stream", d.Stream, "Default stream for the payload command")
+	settings.StringVar(&Current.DbMode, "db-mode", d.DbMode, "Default dbMode for the payload command (rcWebpage, sippyDB, rcAPI)")
+	settings.DurationVar(&Current.BodyTimeout, "body-timeout", d.BodyTimeout, "Timeout to download a page (release controller, sippy, summaries)")
+	settings.DurationVar(&Current.JunitTimeout, "junit-timeout", d.JunitTimeout, "Timeout to download a junit file or build log")
+	settings.DurationVar(&Current.JobDetailTimeout, "job-detail-timeout", d.JobDetailTimeout, "Timeout to show the details of all the sub-jobs of an aggregated job")
+	settings.IntVar(&Current.MaxJobs, "max-jobs", d.MaxJobs, "Number of sub-jobs an aggregated job runs")
+	settings.IntVar(&Current.MaxTests, "max-tests", d.MaxTests, "Maximum number of failed tests to show for a job")
+	settings.IntVar(&Current.MaxChar, "max-char", d.MaxChar, "Maximum number of characters of a failed test summary line when the terminal width is unknown (otherwise it is wrapped)")
+	settings.StringVar(&Current.LogLevel, "log-level", d.LogLevel, "Log level for diagnostics on stderr (debug, info, warn, error)")
+	settings.StringVar(&Current.LogFormat, "log-format", d.LogFormat, "Format of the diagnostics on stderr (text, json)")
+	settings.StringVar(&Current.Releases, "releases", d.Releases, "Comma separated version/stream pairs (e.g., 4.16/nightly,4.17/ci) for serve to analyze (the version and stream settings by default)")
+	settings.StringVar(&Current.Color, "color", d.Color, "Color the output and make urls hyperlinks (auto: only on a terminal and if NO_COLOR isn't set; always, never)")
+}
+
+// Flag returns the flag for the setting name so a command can add it to its flags.
+func Flag(name string) *pflag.Flag {
+	f := settings.Lookup(name)
+	if f == nil {
+		panic("config: no setting " + name)
+	}
+	return f
+}
+
+// EnvName returns the environment variable for the setting name.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// DefaultPath returns ~/.config/release-analysis/config.yaml (or the OS's equivalent).
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "release-analysis", "config.yaml"), nil
+}
+
+// Load sets Current from the defaults, the config file at path, the environment and the flags
+// given on the command line (in increasing order of precedence).  It's not an error for the
+// file not to exist unless mustExist (i.e., the user asked for that file).
+func Load(path string, mustExist bool) error {
+	// The flags are bound to Current so remember what was given before starting over.
+	given := map[string]string{}
+	settings.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			given[f.Name] = f.Value.String()
+		}
+		Sources[f.Name] = "default"
+	})
+	Current = Default()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !mustExist:
+	case err != nil:
+		return err
+	default:
+		values := map[string]yaml.Node{}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for name, value := range values {
+			if err := set(name, yamlString(value), "file"); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	var errs []error
+	settings.VisitAll(func(f *pflag.Flag) {
+		if value, ok := os.LookupEnv(EnvName(f.Name)); ok {
+			errs = append(errs, set(f.Name, value, EnvName(f.Name)))
+		}
+	})
+	for name, value := range given {
+		errs = append(errs, set(name, value, "flag"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return validate()
+}
+
+// yamlString returns a value from the config file as it would be given as a flag (as written so
+// that, e.g., 4.10 isn't 4.1); lists (e.g., releases) are comma separated.
+func yamlString(value yaml.Node) string {
+	if value.Kind != yaml.SequenceNode {
+		return value.Value
+	}
+	items := []string{}
+	for _, item := range value.Content {
+		items = append(items, item.Value)
+	}
+	return strings.Join(items, ",")
+}
+
+// set sets the setting name to value and remembers where it came from.
+func set(name, value, source string) error {
+	f := settings.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("unknown setting %q", name)
+	}
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("bad %s %q (%s): %w", name, value, source, err)
+	}
+	Sources[name] = source
+	return nil
+}
+
+// validate checks the settings that only take a few values (the log settings are checked when
+// the logger is set up).
+func validate() error {
+	oneOf := func(name, value string, allowed ...string) error {
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("bad %s %q (%s; use %s)", name, value, Sources[name], strings.Join(allowed, ", "))
+	}
+	return errors.Join(
+		oneOf("stream", Current.Stream, "nightly", "ci"),
+		oneOf("db-mode", Current.DbMode, "rcWebpage", "sippyDB", "rcAPI"),
+		oneOf("color", Current.Color, "auto", "always", "never"),
+	)
+}
+
+// Create the config command
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show the settings (defaults and tuning) from the config file, environment and flags",
+	Long:  `Settings come from ~/.config/release-analysis/config.yaml (or --config), RELEASE_ANALYSIS_* environment variables and flags`,
+}
+
+// Create the config view command
+var ConfigViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Show the effective value of every setting and where it came from",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		View(os.Stdout)
+	},
+}
+
+func NewConfigCmd() *cobra.Command {
+	ConfigCmd.AddCommand(ConfigViewCmd)
+	return ConfigCmd
+}
+
+// View writes every setting to w as a config file, with where it came from as a comment.
+func View(w io.Writer) {
+	fmt.Fprintf(w, "# %s\n", Path)
+	settings.VisitAll(func(f *pflag.Flag) {
+		value := f.Value.String()
+		if f.Value.Type() == "string" {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(w, "%-20s %-12s # %s\n", f.Name+":", value, Sources[f.Name])
+	})
+}
@@ -0,0 +1,609 @@
+// Package e2e runs the payload and analysis commands end to end against a fake release
+// controller, sippy, prow and gcsweb serving the canned fixtures in testdata.
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dperique/release-analysis/config"
+	"github.com/dperique/release-analysis/fetch"
+	"github.com/dperique/release-analysis/releaseanalysiscommands"
+	"github.com/spf13/cobra"
+)
+
+const (
+	prowUrl = "https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/"
+	rcUrl   = "https://amd64.ocp.releases.ci.openshift.org/releasestream/4.16.0-0.nightly/release/"
+
+	rejectedPayload     = "4.16.0-0.nightly-2024-04-21-120000"
+	acceptedPayload     = "4.16.0-0.nightly-2024-04-21-060000"
+	notServingPayload   = "4.16.0-0.nightly-2024-04-20-180000"
+	agedOutPayload      = "4.16.0-0.nightly-2024-04-10-000000"
+	aggrAwsJob          = "aggregated-aws-ovn-upgrade-4.16-micro-release-openshift-release-analysis-aggregator/1782000000000000001"
+	aggrAzureJob        = "aggregated-azure-ovn-upgrade-4.16-minor-release-openshift-release-analysis-aggregator/1782000000000000003"
+	serialJob           = "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-sdn-serial/1782000000000000201"
+	installJob          = "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn/1782000000000000301"
+	notServingSerialJob = "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn-serial/1782000000000000501"
+	releaseJob          = "release-openshift-ocp-installer-e2e-metal-serial/1782000000000000601"
+	layoutJob           = "release-openshift-origin-installer-old-rhcos-e2e-aws/1782000000000000701"
+)
+
+// root is created once since the commands (and their flags) are package level variables.
+var root *cobra.Command
+
+// fakeTarget is where the fake CI serves; rewriteTransport sends every request there.
+var fakeTarget *url.URL
+
+func TestMain(m *testing.M) {
+	// Don't pick up the settings of whoever runs the tests.
+	configHome, err := os.MkdirTemp("", "release-analysis-e2e")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", configHome)
+	os.Setenv("XDG_CONFIG_HOME", configHome)
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, config.EnvPrefix) {
+			os.Unsetenv(name)
+		}
+	}
+
+	fake := newFakeCI()
+	fakeTarget, _ = url.Parse(fake.server.URL)
+	fetch.Default = fetch.New(fetch.Config{
+		Transport:         rewriteTransport{target: fakeTarget},
+		RequestsPerSecond: 1000,
+		Burst:             1000,
+		MaxRetries:        1,
+		Backoff:           time.Millisecond,
+	})
+	root = releaseanalysiscommands.CreateRelContCommand()
+
+	code := m.Run()
+	fake.Close()
+	os.RemoveAll(configHome)
+	os.Exit(code)
+}
+
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// capture replaces *f (os.Stdout or os.Stderr) with a pipe; the returned function puts it back
+// and returns what was written (without colors).
+func capture(t *testing.T, f **os.File) func() string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *f
+	*f = w
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		out <- buf.String()
+	}()
+	return func() string {
+		w.Close()
+		*f = saved
+		return ansiRegex.ReplaceAllString(<-out, "")
+	}
+}
+
+// runWithLogs runs the command line in args and returns what it printed on stdout and stderr.
+// Flags keep their values between runs so the global flags are reset to their defaults and every
+// test passes all the command flags it cares about.
+func runWithLogs(t *testing.T, args ...string) (string, string) {
+	t.Helper()
+	output, logs, err := execute(t, args...)
+	if err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, output)
+	}
+	if testing.Verbose() {
+		t.Logf("%v:\n%s", args, output)
+	}
+	return output, logs
+}
+
+// execute runs the command line in args and returns what it printed on stdout and stderr and the
+// error the command returned.
+func execute(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	stdout := capture(t, &os.Stdout)
+	stderr := capture(t, &os.Stderr)
+
+	root.SetArgs(append([]string{"--no-cache", "--record=", "--replay=", "-v=false", "--log-level", "warn", "--log-format", "text", "--color", "auto"}, args...))
+	err := root.Execute()
+
+	logs := stderr()
+	return stdout(), logs, err
+}
+
+// run runs the command line in args and returns what it printed on stdout.
+func run(t *testing.T, args ...string) string {
+	t.Helper()
+	output, _ := runWithLogs(t, args...)
+	return output
+}
+
+// expect fails the test for each of want that isn't in output.
+func expect(t *testing.T, output string, want ...string) {
+	t.Helper()
+	for _, s := range want {
+		if !strings.Contains(output, s) {
+			t.Errorf("expected output to contain %q", s)
+		}
+	}
+}
+
+// expectNot fails the test for each of unwanted that is in output.
+func expectNot(t *testing.T, output string, unwanted ...string) {
+	t.Helper()
+	for _, s := range unwanted {
+		if strings.Contains(output, s) {
+			t.Errorf("expected output to not contain %q", s)
+		}
+	}
+}
+
+func payloadArgs(dbMode string, extra ...string) []string {
+	args := []string{"payload", "4.16", "nightly", "-d", dbMode, "-a", "true", "-s", "false", "-c", "false", "-t", "false", "-j", "false"}
+	return append(args, extra...)
+}
+
+func analysisArgs(url string) []string {
+	return []string{"analysis", url, "-d=false"}
+}
+
+// TestPayloadGetters lists the same payloads with each way of getting them.
+func TestPayloadGetters(t *testing.T) {
+	for _, dbMode := range []string{"rcWebpage", "sippyDB", "rcAPI"} {
+		t.Run(dbMode, func(t *testing.T) {
+			output := run(t, payloadArgs(dbMode)...)
+			expect(t, output,
+				rejectedPayload+"  Rejected",
+				acceptedPayload+"  Accepted",
+				notServingPayload+"  Rejected",
+				agedOutPayload+" Accepted",
+				"aggregated-aws-ovn-upgrade-4.16-micro  Failed",
+				"aggregated-gcp-ovn-upgrade-4.16-micro  Failed",
+				"aws-sdn-serial  Failed",
+				"aws-ovn  Failed",
+				"Finished listing the payloads",
+			)
+			// Only failed jobs are shown by default.
+			expectNot(t, output, "gcp-ovn  Succeeded")
+		})
+	}
+}
+
+func TestPayloadTimes(t *testing.T) {
+	expect(t, run(t, payloadArgs("rcWebpage")...), rejectedPayload+"  Rejected  3 hours ago  04-21T12:00:00Z")
+	expect(t, run(t, payloadArgs("sippyDB")...), rejectedPayload+"  Rejected  2024-04-21T12:00:00Z")
+	expect(t, run(t, payloadArgs("rcAPI")...), rejectedPayload+"  Rejected  Unknown ago")
+}
+
+func TestPayloadShowSuccess(t *testing.T) {
+	output := run(t, payloadArgs("rcAPI", "-c", "true")...)
+	expect(t, output, "gcp-ovn  Succeeded")
+}
+
+// TestAggregatedSummaryVariants checks each kind of line in aggregation-testrun-summary.html.
+func TestAggregatedSummaryVariants(t *testing.T) {
+	output := run(t, analysisArgs(prowUrl+aggrAwsJob)...)
+	expect(t, output,
+		"Aggregation job",
+		"Failed: [sig-network] pods should successfully create sandboxes by other",
+		"pass=0/fail=10/skip=0",
+		"pass=2/fail=8/req=6/skip=0",
+		"pass=5/fail=5/req=6  historical=99%",
+		"pass=?/fail=?/req=? dev=12.30 disruption",
+		"pass=0/fail=10/req=? disruption, P95=4.00s, 7, 9",
+		"some summary line nobody has seen before (?disruption)",
+		"6 failures: 2 sig-network, 1 sig-api-machinery, 1 sig-storage, 1 sig-network-edge, 1 sig-cli",
+		"Distance to pass (more passes needed, closest first):",
+		"1  pass=5/req=6 [sig-storage] CSI Mock volume expansion",
+		"Disruption failure count: 2/6",
+		`"aggr-aws-ovn-upgrade-1782000000000000001": [`,
+		"periodic-ci-openshift-release-master-ci-4.16-e2e-aws-ovn-upgrade/1782000000000000110",
+	)
+	expectNot(t, output, "Error parsing float", "[sig-node] pods should run")
+}
+
+func TestAggregatedJobDetail(t *testing.T) {
+	output := run(t, payloadArgs("rcAPI", "-s", "true", "-t", "true", "-j", "true")...)
+	expect(t, output,
+		"1782000000000000101 build01 fail  2h10m3s",
+		// There's no prowjob.json for the last job so we don't know its build farm.
+		"1782000000000000110 build?? succ  2h19m3s",
+		"Warning: Got 8 of 10 jobs",
+		// The failed sub-job's junit is analyzed like a plain job.
+		"openshift-e2e-test (junit_e2e_20240421-123000.xml)",
+		"Failure signatures (2):",
+		"[1 tests, 2 jobs, 1 payloads] fail [github.com/openshift/origin/test/extended/apiserver/graceful_termination.go:<n>]: Unexpected error:",
+	)
+}
+
+func TestAggregatedCorrelation(t *testing.T) {
+	output := run(t, analysisArgs(rcUrl+rejectedPayload)...)
+	expect(t, output,
+		"Payload item",
+		"Aggregated test correlation",
+		"[1] aggregated-aws-ovn-upgrade-4.16-micro",
+		"[2] aggregated-gcp-ovn-upgrade-4.16-micro",
+		"2 test(s) failed on more than one aggregated job; suspect a product regression",
+	)
+	// Marked without color too.
+	expect(t, output, "  * [sig-network] pods should successfully create sandboxes")
+	expectNot(t, output, "  * [sig-cli]")
+}
+
+// TestPlainJob checks the junit path used for jobs that aren't aggregated.
+func TestPlainJob(t *testing.T) {
+	output := run(t, analysisArgs(prowUrl+serialJob)...)
+	expect(t, output,
+		"Plain job",
+		"openshift-e2e-test (junit_e2e_20240421-131500.xml)",
+		"Failed: [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver",
+		"1 failure: 1 sig-api-machinery",
+		"Flaked: 1 test(s)",
+		"Flaked: [sig-network] pods should successfully create sandboxes by other (failed 1 of 2 attempts)",
+	)
+	// The test that failed on a node in gather-extra/artifacts/pods/ignored.json isn't a failure.
+	expectNot(t, output, "No test failures found in junit")
+}
+
+func TestInstallFailure(t *testing.T) {
+	output := run(t, analysisArgs(prowUrl+installJob)...)
+	expect(t, output,
+		"Failed: Run multi-stage test e2e-aws-ovn - e2e-aws-ovn-ipi-install-install container test",
+		"No test failures found in junit; failed steps:",
+		"Step ipi-install-install (e2e-aws-ovn) FAILURE after 22m22s",
+		"ipi-install-install/build-log.txt",
+		"Installer exit with code 4",
+		"Install failure: cloud-quota (the cloud account ran out of quota or capacity), 1 line(s)",
+		".openshift_install-1713701100.log: ",
+	)
+}
+
+// TestNotServing checks that artifacts that aren't available are reported with the job's status
+// and don't stop the analysis.
+func TestNotServing(t *testing.T) {
+	// The aggregated job finished so its summary is missing.
+	output := run(t, analysisArgs(prowUrl+aggrAzureJob)...)
+	expect(t, output, "Aggregation job", "[artifact-missing] ", "/aggregation-testrun-summary.html: 503 Service Unavailable")
+
+	// The plain job has no finished.json so its artifacts are not uploaded yet.
+	output = run(t, analysisArgs(prowUrl+notServingSerialJob)...)
+	expect(t, output, "Plain job", "[not-yet-uploaded] ", notServingSerialJob+"/artifacts/: 503 Service Unavailable")
+	expectNot(t, output, "Failed:")
+
+	output = run(t, payloadArgs("rcAPI")...)
+	expect(t, output,
+		"aggregated-azure-ovn-upgrade-4.16-minor  Failed",
+		"aws-ovn-serial  Failed",
+		"Incomplete results: 1 not-yet-uploaded, 1 artifact-missing",
+		agedOutPayload+" Accepted",
+	)
+}
+
+// TestJobStatus checks the statuses of jobs whose artifacts are there but not usable.
+func TestJobStatus(t *testing.T) {
+	output := run(t, analysisArgs(prowUrl+serialJob)...)
+	expect(t, output, "[parse-error] ", "junit_broken.xml: parse error: ")
+
+	// The other failed sub-job of the aggregated job has artifacts but no junit or steps; it counts
+	// toward the aggregated job's status.
+	output = run(t, payloadArgs("rcAPI", "-s", "true", "-j", "true")...)
+	expect(t, output,
+		"[unsupported-layout] ", "1782000000000000102/artifacts/: no junit files or failed steps found",
+		"Incomplete results: 1 parse-error, 1 unsupported-layout",
+	)
+}
+
+// TestAgedOutPayload checks a payload whose release page is gone.
+func TestAgedOutPayload(t *testing.T) {
+	output := run(t, analysisArgs(rcUrl+agedOutPayload)...)
+	expect(t, output, "Payload item", agedOutPayload, "[artifact-missing] ", "404 Not Found")
+}
+
+// TestLogging checks that diagnostics go to stderr (as JSON if asked) and stdout only has the
+// analysis.
+// TestCommandErrors checks that what keeps a command from doing its job makes it fail (and exit
+// non-zero) instead of printing nothing.
+func TestCommandErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	for _, flag := range []string{"--rules", "--sig-map", "--install-signatures"} {
+		for _, args := range [][]string{payloadArgs("rcAPI"), analysisArgs(rcUrl + rejectedPayload)} {
+			args = append(args, flag, missing)
+			if _, logs, err := execute(t, args...); err == nil || !strings.Contains(logs, missing) {
+				t.Errorf("%v: expected an error about %s, got %v:\n%s", args, missing, err, logs)
+			}
+			// Flags keep their values between runs.
+			cmd, _, _ := root.Find(args[:1])
+			cmd.Flags().Set(flag[2:], "")
+		}
+	}
+
+	// There are no 4.15 payloads in the fake CI.
+	output, _, err := execute(t, "payload", "4.15", "nightly", "-d", "rcAPI")
+	if err == nil {
+		t.Errorf("expected an error listing the 4.15 payloads")
+	}
+	expect(t, output, "[artifact-missing] https://amd64.ocp.releases.ci.openshift.org/api/v1/releasestream/4.15.0-0.nightly/tags: 404 Not Found")
+}
+
+func TestLogging(t *testing.T) {
+	output, logs := runWithLogs(t, append([]string{"-v", "--log-format", "json"}, payloadArgs("rcAPI")...)...)
+	expectNot(t, output, "Run called", "dbMode:", "Download problem", "first part", `"level"`)
+	expect(t, output, "aggregated-aws-ovn-upgrade-4.16-micro  Failed")
+
+	found := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(logs), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		msg, _ := entry["msg"].(string)
+		if msg == "download failed" {
+			if entry["op"] == nil || entry["url"] == nil || entry["elapsed"] == nil {
+				t.Errorf("download failure without op, url or elapsed: %q", line)
+			}
+		}
+		found[msg] = true
+	}
+	for _, msg := range []string{"payload options", "fetch", "download failed", "payload done"} {
+		if !found[msg] {
+			t.Errorf("expected a %q log entry", msg)
+		}
+	}
+
+	// The default level only shows problems.
+	_, logs = runWithLogs(t, analysisArgs(prowUrl+aggrAzureJob)...)
+	expect(t, logs, "level=WARN", `msg="download failed" op=printAggrSummaryTests`)
+	expectNot(t, logs, "level=DEBUG", "level=INFO")
+}
+
+// TestConfig checks that settings come from the config file, then the environment, then flags.
+func TestConfig(t *testing.T) {
+	configFile := t.TempDir() + "/config.yaml"
+	err := os.WriteFile(configFile, []byte("stream: ci\nmax-jobs: 8\nmax-tests: 5\nlog-level: debug\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RELEASE_ANALYSIS_CONFIG", configFile)
+	t.Setenv("RELEASE_ANALYSIS_MAX_TESTS", "7")
+	t.Setenv("RELEASE_ANALYSIS_LOG_LEVEL", "info")
+
+	output := run(t, "config", "view")
+	expect(t, output,
+		"# "+configFile,
+		`stream:              "ci"         # file`,
+		"max-jobs:            8            # file",
+		"max-tests:           7            # RELEASE_ANALYSIS_MAX_TESTS",
+		`log-level:           "warn"       # flag`,
+		`version:             "4.16"       # default`,
+	)
+
+	// The payload command uses the version and stream settings and, with max-jobs 8, the
+	// aggregated job with only 8 jobs isn't missing any.
+	t.Setenv("RELEASE_ANALYSIS_STREAM", "nightly")
+	output = run(t, "payload", "-d", "rcAPI", "-a", "true", "-s", "true", "-c", "false", "-t", "false", "-j", "false")
+	expect(t, output, "Getting: 4.16 nightly", "aggregated-gcp-ovn-upgrade-4.16-micro  Failed")
+	expectNot(t, output, "Warning: Got 8 of")
+
+	// Bad settings make the command exit so just check that Load rejects them.
+	t.Setenv("RELEASE_ANALYSIS_MAX_JOBS", "ten")
+	if err := config.Load(configFile, true); err == nil || !strings.Contains(err.Error(), "RELEASE_ANALYSIS_MAX_JOBS") {
+		t.Errorf("expected a bad RELEASE_ANALYSIS_MAX_JOBS to be an error, got %v", err)
+	}
+}
+
+// TestTerminal checks the output with colors and hyperlinks and wrapped to the terminal width.
+func TestTerminal(t *testing.T) {
+	// The output isn't a terminal so there's nothing to strip.
+	t.Setenv("COLUMNS", "")
+	output := run(t, analysisArgs(prowUrl+serialJob)...)
+	expectNot(t, output, "\x1b")
+	expect(t, output, "    "+prowUrl+serialJob+"\n")
+
+	t.Setenv("COLUMNS", "80")
+	output = run(t, append(analysisArgs(prowUrl+serialJob), "--color", "always")...)
+	expect(t, output,
+		// The job's url is a link on its name and id.
+		"    \x1b]8;;"+prowUrl+serialJob+"\x1b\\"+serialJob+"\x1b]8;;\x1b\\\n",
+		// The test is a link to sippy and wrapped.
+		"Failed: \x1b]8;;https://sippy.dptools.openshift.org/sippy-ng/tests/4.16/analysis?test=%5Bsig-api-machinery%5D",
+		"\x1b\\[sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz\n      of kube-apiserver",
+	)
+
+	// Aggregated test names are wrapped to the terminal; they're only cut to --max-char when we
+	// don't know how wide it is.
+	csiTest := "[sig-storage] CSI Mock volume expansion should expand volume by restarting pod if attach=on, nodeExpansion=on [Suite:openshift/conformance/parallel]"
+	output = run(t, append(analysisArgs(prowUrl+aggrAwsJob), "--max-char", "60")...)
+	expect(t, output, "Failed: [sig-storage] CSI Mock volume expansion should expand volume by\n      restarting pod if attach=on, nodeExpansion=on\n      [Suite:openshift/conformance/parallel]\n")
+	t.Setenv("COLUMNS", "")
+	output = run(t, append(analysisArgs(prowUrl+aggrAwsJob), "--max-char", "60")...)
+	expect(t, output, "    "+("Failed: " + csiTest)[:60]+"\n")
+	expectNot(t, output, csiTest)
+	output = run(t, append(analysisArgs(prowUrl+aggrAwsJob), "--max-char", "175")...)
+	expect(t, output, "    Failed: "+csiTest+"\n")
+	t.Setenv("COLUMNS", "80")
+
+	// The separator is as wide as the terminal and the payload is a link instead of a url.
+	output = run(t, append(payloadArgs("rcAPI"), "--color", "always")...)
+	expect(t, output,
+		"\n"+strings.Repeat("=", 80)+"\n",
+		"/"+rejectedPayload+"\x1b\\"+rejectedPayload+"\x1b]8;;\x1b\\  Rejected",
+	)
+	expectNot(t, output, "   https://amd64.ocp.releases.ci.openshift.org/")
+}
+
+// TestServe checks the metrics for the latest finished payload (the rejected one).
+func TestServe(t *testing.T) {
+	t.Setenv("RELEASE_ANALYSIS_DB_MODE", "rcAPI")
+	output := run(t, "serve", "--once", "--releases", "4.16/nightly")
+	release := `version="4.16",stream="nightly"`
+	expect(t, output,
+		"# TYPE release_analysis_up gauge\nrelease_analysis_up{"+release+"} 1\n",
+		"release_analysis_time_since_last_accepted_payload_seconds{"+release+"} ",
+		"release_analysis_rejected_payloads{"+release+"} 2\n",
+		"release_analysis_latest_payload_info{"+release+`,payload="`+rejectedPayload+`",phase="Rejected"} 1`,
+		"release_analysis_blocking_job_passed{"+release+`,job="aggregated-aws-ovn-upgrade-4.16-micro"} 0`,
+		"release_analysis_blocking_job_passed{"+release+`,job="gcp-ovn"} 1`,
+		"release_analysis_aggregated_test_failures{"+release+`,job="aggregated-gcp-ovn-upgrade-4.16-micro",test="[sig-network] pods should successfully create sandboxes by other"} 9`,
+		"release_analysis_disruption_seconds{"+release+`,job="aggregated-aws-ovn-upgrade-4.16-micro",backend="openshift-api-new-connections",statistic="mean"} 12.3`,
+		"release_analysis_disruption_seconds{"+release+`,job="aggregated-aws-ovn-upgrade-4.16-micro",backend="ingress-to-oauth-server",statistic="P95"} 4`,
+	)
+}
+
+// TestJobUrls checks that the urls of a job run or payload on each CI service are analyzed the
+// same way as the prow or release controller url.
+func TestJobUrls(t *testing.T) {
+	for _, jobUrl := range []string{
+		"https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/origin-ci-test/logs/" + serialJob + "/",
+		"https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/origin-ci-test/logs/" + serialJob + "/artifacts/e2e-aws-sdn-serial/",
+		"gs://origin-ci-test/logs/" + serialJob,
+		prowUrl + serialJob + "#1:build-log.txt%3A42",
+	} {
+		t.Run(jobUrl, func(t *testing.T) {
+			expect(t, run(t, analysisArgs(jobUrl)...),
+				"Plain job",
+				"Failed: [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver",
+			)
+		})
+	}
+
+	output := run(t, analysisArgs("https://sippy.dptools.openshift.org/sippy-ng/release/4.16/tags/"+rejectedPayload)...)
+	expect(t, output, "Payload item", "Aggregated test correlation")
+
+	output = run(t, analysisArgs("gs://origin-ci-test/logs/"+aggrAwsJob)...)
+	expect(t, output, "Aggregation job", `"aggr-aws-ovn-upgrade-1782000000000000001": [`)
+
+	output, logs := runWithLogs(t, analysisArgs("https://prow.ci.openshift.org/job-history/gs/origin-ci-test/logs/"+serialJob)...)
+	expectNot(t, output, "Plain job")
+	expect(t, logs, "unable to analyze the url")
+}
+
+// TestJobTarget checks that the test a job ran is found for jobs whose name doesn't say.
+func TestJobTarget(t *testing.T) {
+	expect(t, run(t, analysisArgs(prowUrl+serialJob)...), "Plain job (e2e-aws-sdn-serial)")
+	// From the ci-operator --target in prowjob.json.
+	expect(t, run(t, analysisArgs(prowUrl+releaseJob)...),
+		"Plain job (e2e-metal-serial)",
+		"Failed: [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver",
+	)
+	// From the directories in the artifacts.
+	expect(t, run(t, analysisArgs(prowUrl+layoutJob)...), "Plain job (e2e-aws)")
+	expect(t, run(t, analysisArgs(prowUrl+"aggregated-gcp-ovn-upgrade-4.16-micro-release-openshift-release-analysis-aggregator/1782000000000000002")...),
+		`"aggr-gcp-ovn-upgrade-1782000000000000002": [`)
+}
+
+// TestPresubmit checks the jobs of a /payload run on a PR, which are under pr-logs.
+func TestPresubmit(t *testing.T) {
+	prProwUrl := "https://prow.ci.openshift.org/view/gs/test-platform-results/pr-logs/pull/openshift_origin/28000/"
+	prAggrJob := "openshift-origin-28000-aggregator-periodic-ci-openshift-release-master-ci-4.16-e2e-aws-ovn-upgrade/1782000000000000801"
+	prPlainJob := "openshift-origin-28000-nightly-4.16-e2e-aws-ovn-serial/1782000000000000901"
+
+	output := run(t, analysisArgs(prProwUrl+prAggrJob)...)
+	expect(t, output,
+		"Aggregation job",
+		"Failed: [sig-network] pods should successfully create sandboxes by other",
+		"pass=1/fail=9/skip=0",
+		"1782000000000000811 build01 fail  2h10m3s",
+		`"aggr-aws-ovn-upgrade-1782000000000000801": [`,
+		prProwUrl+"openshift-origin-28000-ci-4.16-e2e-aws-ovn-upgrade/1782000000000000812",
+	)
+
+	output = run(t, analysisArgs("gs://test-platform-results/pr-logs/pull/openshift_origin/28000/"+prPlainJob)...)
+	expect(t, output,
+		"Plain job (e2e-aws-ovn-serial)",
+		"Failed: [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver",
+	)
+
+	output = run(t, analysisArgs("https://pr-payload-tests.ci.openshift.org/runs/ci/3a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d-0")...)
+	expect(t, output,
+		"Payload run",
+		"Aggregation job",
+		`"aggr-aws-ovn-upgrade-1782000000000000801": [`,
+		"Plain job (e2e-aws-ovn-serial)",
+	)
+}
+
+// TestJobHistory checks the runs of a job from prow's job history (which has two pages).
+func TestJobHistory(t *testing.T) {
+	job := "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn-techpreview"
+	output := run(t, "job-history", job, "--runs", "22")
+	expect(t, output,
+		job+": last 22 runs (newest first)",
+		"1782000000000001025 build01 fail  2h25m0s ********\n      Failed: [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver",
+		"1782000000000001024 build05 pend       0s",
+		"1782000000000001015 build01 abor  2h15m0s",
+		"[artifact-missing] https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/"+job+"/1782000000000001012/artifacts/: 404 Not Found",
+		// From the second (older) page.
+		"1782000000000001004 build05 succ   2h4m0s",
+		"Incomplete results: 1 artifact-missing",
+		"Pass rate: 85% (17 of 20 finished runs)",
+		"Trend (oldest first): SSSSSSSSFSS-SSSSFSSS-F",
+		"Pass rate every 5 runs (oldest first): 100% 80% 100% 80% 0%",
+		"  2 [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver",
+	)
+	expectNot(t, output, "1782000000000001003")
+
+	// The url of a run works too and says which bucket the job is in.
+	output = run(t, "job-history", "gs://test-platform-results/logs/"+job+"/1782000000000001025", "--runs", "5")
+	expect(t, output, job+": last 5 runs (newest first)", "Pass rate: 75% (3 of 4 finished runs)")
+}
+
+// TestManyUrls checks that many urls (from the args or a file) are analyzed and summarized together.
+func TestManyUrls(t *testing.T) {
+	urlsFile := filepath.Join(t.TempDir(), "urls.jsonl")
+	lines := []string{
+		`# the failed runs from this morning`,
+		`{"id":"1","title":"serial failed","body":"see ` + prowUrl + serialJob + `."}`,
+		`{"id":"2","urls":["` + prowUrl + aggrAwsJob + `","https://github.com/openshift/origin/pull/28000"]}`,
+		prowUrl + serialJob,
+		"",
+		"gs://test-platform-results/pr-logs/pull/openshift_origin/28000/openshift-origin-28000-nightly-4.16-e2e-aws-ovn-serial/1782000000000000901",
+	}
+	if err := os.WriteFile(urlsFile, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The urls in the file come after the args and each is analyzed once; the github url isn't a
+	// job run so it's skipped.
+	output := run(t, append(analysisArgs(prowUrl+installJob), "--file", urlsFile)...)
+	expect(t, output,
+		"[1/4] "+prowUrl+installJob+"\n\nPlain job (e2e-aws-ovn)",
+		"[2/4] "+prowUrl+serialJob+"\n\nPlain job (e2e-aws-sdn-serial)",
+		"[3/4] "+prowUrl+aggrAwsJob+"\n\nAggregation job",
+		"[4/4] gs://test-platform-results/pr-logs/pull/openshift_origin/28000/",
+		"Plain job (e2e-aws-ovn-serial)",
+		"Analyzed 4 urls",
+		"Most failed tests (urls failed in):",
+		"  3 [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver",
+		"  1 [sig-network] pods should successfully create sandboxes by other",
+	)
+	expectNot(t, output, "[5/", "github.com")
+
+	// A test is counted by its whole name even when the aggregated job's output cuts it.
+	t.Setenv("COLUMNS", "")
+	output = run(t, append(analysisArgs(prowUrl+installJob), "--file", urlsFile, "--max-char", "60")...)
+	expect(t, output, "  3 [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver and stop sending requests")
+	expectNot(t, output, "  1 [sig-api-machinery]")
+
+	output = run(t, "analysis", prowUrl+serialJob, prowUrl+layoutJob, "--file=", "--max-char", "175")
+	expect(t, output,
+		"[2/2] "+prowUrl+layoutJob+"\n\nPlain job (e2e-aws)",
+		"Analyzed 2 urls",
+		"  2 [sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver",
+	)
+}
@@ -0,0 +1,145 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// hostDirs maps each CI service we scrape to the testdata directory that plays it.
+var hostDirs = map[string]string{
+	"amd64.ocp.releases.ci.openshift.org":         "testdata/releasecontroller",
+	"sippy.dptools.openshift.org":                 "testdata/sippy",
+	"prow.ci.openshift.org":                       "testdata/prow",
+	"gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com": "testdata/gcsweb",
+	"pr-payload-tests.ci.openshift.org":           "testdata/payloadtests",
+}
+
+// notServingPage is what gcsweb shows for an artifact that isn't there (yet).
+const notServingPage = `<html><body><h1>Application is not available</h1>
+<p>The application is currently not serving requests at this endpoint. It may not have been started or is still starting.</p>
+</body></html>
+`
+
+// fakeCI serves the testdata directories as the release controller, sippy, prow, gcsweb and the
+// payload test run pages.  A file (or directory) named <name>.not-serving makes <name> answer with
+// the "not serving" page and a file named <name>.<key>-<value> answers <name> asked with
+// ?<key>=<value> (a "?" in a file name doesn't work everywhere);
+// anything else that isn't in testdata is a 404.
+type fakeCI struct {
+	server *httptest.Server
+}
+
+func newFakeCI() *fakeCI {
+	f := &fakeCI{}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeCI) Close() {
+	f.server.Close()
+}
+
+// queryName turns a query into the end of the name of the file that answers it, e.g.,
+// ?buildId=1782000000000001006 into .buildId-1782000000000001006.
+func queryName(query url.Values) string {
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	name := ""
+	for _, key := range keys {
+		for _, value := range query[key] {
+			name += "." + key + "-" + value
+		}
+	}
+	return name
+}
+
+func (f *fakeCI) serve(w http.ResponseWriter, r *http.Request) {
+	dir, ok := hostDirs[r.Host]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown host %s", r.Host), http.StatusBadGateway)
+		return
+	}
+	// The tool builds some urls with a double slash (e.g., ".../api/v1//releasestream").
+	p := path.Clean("/" + r.URL.Path)
+	if p == "/" {
+		p = "/index.html"
+	}
+	name := filepath.Join(dir, filepath.FromSlash(p))
+	if query := queryName(r.URL.Query()); query != "" {
+		if _, err := os.Stat(name + query); err == nil {
+			name += query
+		}
+	}
+
+	if _, err := os.Stat(name + ".not-serving"); err == nil {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, notServingPage)
+		return
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if info.IsDir() {
+		f.serveListing(w, p, name)
+		return
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+// serveListing writes a gcsweb style directory listing of dir (whose url path is p).
+func (f *fakeCI) serveListing(w http.ResponseWriter, p, dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := []string{}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".not-serving")
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, "<html><body>\n<h1>%s</h1>\n", p)
+	fmt.Fprintf(w, "<a href=\"%s/\">..</a>\n", path.Dir(p))
+	for _, name := range names {
+		fmt.Fprintf(w, "<a href=\"%s/%s\">%s</a>\n", p, name, name)
+	}
+	fmt.Fprint(w, "</body></html>\n")
+}
+
+// rewriteTransport sends every request to the fake server but keeps the original host (so the
+// fake knows which service was asked for).
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Host = req.URL.Host
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -0,0 +1,114 @@
+package e2e
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dperique/release-analysis/fetch"
+)
+
+var update = flag.Bool("update", false, "Record the replay bundle from the fixtures again and rewrite the golden files")
+
+// replayDir has the bundle recorded (with --record) from the fake CI and what each analysis
+// printed when replaying it.
+const replayDir = "testdata/replay"
+
+// jobRunLineRegex matches the line of a job run of an aggregated job, e.g.,
+// "    1782000000000000109 build04 succ  2h18m3s ********".
+var jobRunLineRegex = regexp.MustCompile(`^ {4}\d{19} `)
+
+// sortJobRuns sorts the job runs of each aggregated job (with the lines under them) since they're
+// printed as they finish.
+func sortJobRuns(output string) string {
+	lines := strings.SplitAfter(output, "\n")
+	sorted := []string{}
+	for i := 0; i < len(lines); {
+		if !jobRunLineRegex.MatchString(lines[i]) {
+			sorted = append(sorted, lines[i])
+			i++
+			continue
+		}
+		runs := []string{}
+		for i < len(lines) && jobRunLineRegex.MatchString(lines[i]) {
+			run := lines[i]
+			for i++; i < len(lines) && strings.HasPrefix(lines[i], "      "); i++ {
+				run += lines[i]
+			}
+			runs = append(runs, run)
+		}
+		sort.Strings(runs)
+		sorted = append(sorted, runs...)
+	}
+	return strings.Join(sorted, "")
+}
+
+// TestReplay replays the recorded bundle and compares what a payload and an aggregated job analysis
+// print to the golden files; go test ./e2e -run TestReplay -update records them again.
+func TestReplay(t *testing.T) {
+	t.Setenv("COLUMNS", "")
+	saved := fetch.Default
+	t.Cleanup(func() { fetch.Default = saved })
+	bundle := filepath.Join(replayDir, "bundle")
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		// ProcessPayloadItem: the blocking jobs of a payload, aggregated ones included.
+		{"payload", analysisArgs(rcUrl + rejectedPayload)},
+		// PrintAggrSummaryTests
+		{"aggregated", analysisArgs(prowUrl + aggrAwsJob)},
+	}
+
+	if *update {
+		if err := os.RemoveAll(bundle); err != nil {
+			t.Fatal(err)
+		}
+		transport, err := fetch.NewRecordTransport(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport.Next = rewriteTransport{target: fakeTarget}
+		fetch.Default = fetch.New(fetch.Config{
+			Transport:         transport,
+			RequestsPerSecond: 1000,
+			Burst:             1000,
+			MaxRetries:        1,
+			Backoff:           time.Millisecond,
+		})
+	}
+	recorded := map[string]string{}
+	if *update {
+		for _, tt := range tests {
+			recorded[tt.name] = sortJobRuns(run(t, tt.args...))
+		}
+	}
+
+	for _, tt := range tests {
+		output := sortJobRuns(run(t, append([]string{"--replay", bundle}, tt.args...)...))
+		golden := filepath.Join(replayDir, tt.name+".golden")
+		if *update {
+			if output != recorded[tt.name] {
+				t.Errorf("%s: the replayed output isn't what was printed while recording:\n%s", tt.name, output)
+				continue
+			}
+			if err := os.WriteFile(golden, []byte(output), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != string(want) {
+			t.Errorf("%s: the replayed output isn't %s (go test ./e2e -run TestReplay -update records it again):\n%s", tt.name, golden, output)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Forever is the TTL of artifacts that never change (e.g., junit files of a finished job).
+	Forever time.Duration = -1
+
+	// ShortTTL is for things that can still change (e.g., a release page, a job that's still running
+	// or a directory listing).  It's short enough to not miss anything in a 15 minute loop.
+	ShortTTL = 5 * time.Minute
+
+	// DefaultMaxCacheSize is how big the cache can get before the least recently used entries are removed.
+	DefaultMaxCacheSize int64 = 2 << 30
+
+	// maxEntrySize is the biggest body we cache; bigger ones (e.g., log bundles) are rarely looked
+	// at twice and would push everything else out.
+	maxEntrySize int64 = 200 << 20
+
+	// maxDrain is how much of an unread body we read on Close so it can be cached (the xml decoder
+	// stops at the end of the root element and leaves a newline or so behind).
+	maxDrain = 64 << 10
+
+	// notServing is the text of the page shown when an artifact is not available.
+	notServing = "The application is currently not serving requests at this endpoint"
+)
+
+// Policy returns how long the body of url can be cached; 0 means don't cache it.  body is the
+// first maxPolicyHead bytes of a streamed body (see Open).  runFinished says whether the prow job
+// run url is under (if any) has finished.
+type Policy func(url string, body []byte, runFinished bool) time.Duration
+
+// maxPolicyHead is how much of a streamed body is kept for the policy to look at; the not serving
+// page and a prowjob.json fit.
+const maxPolicyHead = 64 << 10
+
+// jobRunRegex matches the url of a file of a prow job run (in gcsweb or GCS) and captures the run,
+// e.g., .../logs/<job>/<build id> or .../pr-logs/pull/<org>_<repo>/<pr>/<job>/<build id>.
+var jobRunRegex = regexp.MustCompile(`^(.+?/(?:logs/[^/]+|pr-logs/pull/[^/]+/\d+/[^/]+)/\d+)/[^?#]*[^/]$`)
+
+// jobRun returns the run url is a file of (e.g., .../logs/<job>/<build id>).
+func jobRun(url string) (string, bool) {
+	if !strings.Contains(url, "/gcs/") && !strings.Contains(url, "storage.googleapis.com/") {
+		return "", false
+	}
+	m := jobRunRegex.FindStringSubmatch(url)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// isRunState returns true for the files that say whether a run finished; they're cached based on
+// what they say instead of on the run's state.
+func isRunState(url string) bool {
+	base := path.Base(url)
+	return base == "finished.json" || base == "prowjob.json"
+}
+
+// DefaultPolicy caches the artifacts of a finished prow job run (files in GCS) forever; they get
+// ShortTTL while the run is still going (and so does anything that isn't a run's file).  A run's
+// finished.json (it's only written at the end) and a prowjob.json with a completion time are
+// cached forever.  Error pages are never cached.
+func DefaultPolicy(url string, body []byte, runFinished bool) time.Duration {
+	if bytes.Contains(body, []byte(notServing)) {
+		return 0
+	}
+	if _, ok := jobRun(url); !ok {
+		return ShortTTL
+	}
+	switch path.Base(url) {
+	case "finished.json":
+		return Forever
+	case "prowjob.json":
+		if bytes.Contains(body, []byte(`"completionTime"`)) {
+			return Forever
+		}
+		return ShortTTL
+	}
+	if runFinished {
+		return Forever
+	}
+	return ShortTTL
+}
+
+// DefaultCacheDir returns ~/.cache/release-analysis (or the OS's equivalent).
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "release-analysis"), nil
+}
+
+// cacheMeta is saved next to each cached body.
+type cacheMeta struct {
+	URL     string    `json:"url"`
+	Stored  time.Time `json:"stored"`
+	Expires time.Time `json:"expires"` // zero means never
+}
+
+// Cache is an on-disk cache of url bodies keyed by url; it is safe for concurrent use (and for use
+// by several processes since entries are written to a temporary file and renamed).
+type Cache struct {
+	Dir     string
+	MaxSize int64
+	Policy  Policy
+
+	mu   sync.Mutex
+	size int64 // -1 until we've looked
+
+	// runs remembers whether a run finished: true for good, false until the time it was checked
+	// plus ShortTTL.
+	runsMu sync.Mutex
+	runs   map[string]runState
+}
+
+// runState is what we know about whether a prow job run finished.
+type runState struct {
+	finished bool
+	checked  time.Time
+}
+
+// runFinished returns whether run finished and whether we know.
+func (c *Cache) runFinished(run string) (bool, bool) {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+	state, ok := c.runs[run]
+	if !ok || !state.finished && time.Since(state.checked) > ShortTTL {
+		return false, false
+	}
+	return state.finished, true
+}
+
+// setRunFinished remembers whether run finished.
+func (c *Cache) setRunFinished(run string, finished bool) {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+	if c.runs == nil {
+		c.runs = map[string]runState{}
+	}
+	c.runs[run] = runState{finished: finished, checked: time.Now()}
+}
+
+// NewCache returns a cache in dir using DefaultPolicy and DefaultMaxCacheSize.
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: dir, MaxSize: DefaultMaxCacheSize, Policy: DefaultPolicy, size: -1}, nil
+}
+
+// paths returns the body and meta file paths for url.
+func (c *Cache) paths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	base := filepath.Join(c.Dir, key[:2], key)
+	return base + ".body", base + ".meta"
+}
+
+// lookup returns the body file of url if it's cached and not expired.
+func (c *Cache) lookup(url string) (*os.File, bool) {
+	bodyPath, metaPath := c.paths(url)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, false
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.URL != url {
+		return nil, false
+	}
+	if !meta.Expires.IsZero() && time.Now().After(meta.Expires) {
+		return nil, false
+	}
+	f, err := os.Open(bodyPath)
+	if err != nil {
+		return nil, false
+	}
+	// The modification time is used as the last use time when pruning.
+	now := time.Now()
+	_ = os.Chtimes(metaPath, now, now)
+	return f, true
+}
+
+// Get returns the cached body of url.
+func (c *Cache) Get(url string) ([]byte, bool) {
+	f, ok := c.lookup(url)
+	if !ok {
+		return nil, false
+	}
+	defer f.Close()
+	body, err := io.ReadAll(f)
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// Open returns a reader for the cached body of url.
+func (c *Cache) Open(url string) (io.ReadCloser, bool) {
+	return c.lookup(url)
+}
+
+// Put caches body (if the policy allows it); runFinished says whether the run url is a file of has
+// finished.
+func (c *Cache) Put(url string, body []byte, runFinished bool) {
+	ttl := c.Policy(url, body, runFinished)
+	if ttl == 0 || int64(len(body)) > maxEntrySize {
+		return
+	}
+	w, err := c.newWriter(url)
+	if err != nil {
+		return
+	}
+	if _, err := w.Write(body); err != nil {
+		w.abort()
+		return
+	}
+	w.commit(ttl)
+}
+
+// cacheWriter writes a body to a temporary file that is renamed into place by commit.
+type cacheWriter struct {
+	c    *Cache
+	url  string
+	tmp  *os.File
+	size int64
+}
+
+func (c *Cache) newWriter(url string) (*cacheWriter, error) {
+	bodyPath, _ := c.paths(url)
+	if err := os.MkdirAll(filepath.Dir(bodyPath), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(bodyPath), ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &cacheWriter{c: c, url: url, tmp: tmp}, nil
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	w.size += int64(len(p))
+	if w.size > maxEntrySize {
+		return 0, io.ErrShortWrite
+	}
+	return w.tmp.Write(p)
+}
+
+func (w *cacheWriter) abort() {
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+}
+
+// commit puts the body in the cache for ttl.
+func (w *cacheWriter) commit(ttl time.Duration) {
+	if err := w.tmp.Close(); err != nil {
+		os.Remove(w.tmp.Name())
+		return
+	}
+	bodyPath, metaPath := w.c.paths(w.url)
+	if err := os.Rename(w.tmp.Name(), bodyPath); err != nil {
+		os.Remove(w.tmp.Name())
+		return
+	}
+	meta := cacheMeta{URL: w.url, Stored: time.Now()}
+	if ttl != Forever {
+		meta.Expires = meta.Stored.Add(ttl)
+	}
+	data, _ := json.Marshal(meta)
+	if err := os.WriteFile(metaPath, data, 0644); err != nil {
+		return
+	}
+	w.c.added(w.size)
+}
+
+// added keeps track of the size of the cache and prunes it when it gets too big.
+func (c *Cache) added(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size < 0 {
+		c.size, _ = c.diskSize()
+	} else {
+		c.size += n
+	}
+	if c.MaxSize > 0 && c.size > c.MaxSize {
+		c.size, _ = c.prune(c.MaxSize * 9 / 10)
+	}
+}
+
+// teeReader saves a streamed body to the cache as it's read; it's only committed if the whole body
+// was read and the policy allows it (given the start of the body).
+type teeReader struct {
+	io.ReadCloser
+	w           *cacheWriter
+	head        []byte // the first maxPolicyHead bytes
+	runFinished bool
+	done        bool
+	err         bool
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 && !t.err {
+		if _, werr := t.w.Write(p[:n]); werr != nil {
+			t.err = true
+		}
+		if len(t.head) < maxPolicyHead {
+			t.head = append(t.head, p[:min(n, maxPolicyHead-len(t.head))]...)
+		}
+	}
+	if err == io.EOF {
+		t.done = true
+	}
+	return n, err
+}
+
+func (t *teeReader) Close() error {
+	if !t.done && !t.err {
+		// Read a little more in case the reader stopped right before the end.
+		if _, err := io.CopyN(io.Discard, t, maxDrain); err == nil {
+			t.err = true
+		}
+	}
+	err := t.ReadCloser.Close()
+	ttl := time.Duration(0)
+	if t.done && !t.err {
+		ttl = t.w.c.Policy(t.w.url, t.head, t.runFinished)
+	}
+	if ttl != 0 {
+		t.w.commit(ttl)
+	} else {
+		t.w.abort()
+	}
+	return err
+}
+
+// tee returns a reader that caches body as it's read (if the policy allows it once it's read);
+// runFinished says whether the run url is a file of has finished.
+func (c *Cache) tee(url string, body io.ReadCloser, runFinished bool) io.ReadCloser {
+	w, err := c.newWriter(url)
+	if err != nil {
+		return body
+	}
+	return &teeReader{ReadCloser: body, w: w, runFinished: runFinished}
+}
+
+// cacheEntry is what prune knows about an entry.
+type cacheEntry struct {
+	bodyPath, metaPath string
+	size               int64
+	lastUsed           time.Time
+	expired            bool
+}
+
+// entries returns every entry in the cache (and removes stale temporary files).
+func (c *Cache) entries() ([]cacheEntry, error) {
+	entries := []cacheEntry{}
+	err := filepath.WalkDir(c.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			if time.Since(info.ModTime()) > time.Hour {
+				os.Remove(p)
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".meta") {
+			return nil
+		}
+		e := cacheEntry{metaPath: p, bodyPath: strings.TrimSuffix(p, ".meta") + ".body", lastUsed: info.ModTime()}
+		if bodyInfo, err := os.Stat(e.bodyPath); err == nil {
+			e.size = bodyInfo.Size()
+		}
+		var meta cacheMeta
+		if data, err := os.ReadFile(p); err != nil || json.Unmarshal(data, &meta) != nil {
+			e.expired = true
+		} else if !meta.Expires.IsZero() && time.Now().After(meta.Expires) {
+			e.expired = true
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// diskSize returns the size of the cached bodies.
+func (c *Cache) diskSize() (int64, error) {
+	entries, err := c.entries()
+	var size int64
+	for _, e := range entries {
+		size += e.size
+	}
+	return size, err
+}
+
+// prune removes expired entries and then the least recently used ones until the cache is at most
+// maxSize bytes; it returns the new size.
+func (c *Cache) prune(maxSize int64) (int64, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.After(entries[j].lastUsed)
+	})
+	var size int64
+	for _, e := range entries {
+		if e.expired || maxSize <= 0 || size+e.size > maxSize {
+			os.Remove(e.metaPath)
+			os.Remove(e.bodyPath)
+			continue
+		}
+		size += e.size
+	}
+	return size, nil
+}
+
+// Prune removes expired entries and then the least recently used ones until the cache is at most
+// maxSize bytes (0 removes everything); it returns how many bytes are left.
+func (c *Cache) Prune(maxSize int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size, err := c.prune(maxSize)
+	c.size = size
+	return size, err
+}
+
+// Size returns how many bytes are in the cache.
+func (c *Cache) Size() (int64, error) {
+	return c.diskSize()
+}
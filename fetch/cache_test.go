@@ -0,0 +1,129 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	const job = "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn/1782000000000000301"
+	notServingPage := []byte("<h1>Application is not available</h1><p>" + notServing + ".</p>")
+	tests := []struct {
+		name     string
+		url      string
+		body     []byte
+		finished bool
+		want     time.Duration
+	}{
+		{"junit file of a finished run", job + "/artifacts/junit/junit_e2e.xml", []byte("<testsuite/>"), true, Forever},
+		{"junit file of a running job", job + "/artifacts/junit/junit_e2e.xml", []byte("<testsuite/>"), false, ShortTTL},
+		{"aggregation summary of a running job", job + "/artifacts/release-analysis-aggregator/aggregation-testrun-summary.html", []byte("<html>"), false, ShortTTL},
+		{"storage.googleapis.com file of a finished run", "https://storage.googleapis.com/test-platform-results/logs/job/1/build-log.txt", []byte("log"), true, Forever},
+		{"presubmit file of a finished run", "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/pr-logs/pull/openshift_origin/28000/pull-ci-openshift-origin-master-e2e-aws-ovn/1/build-log.txt", []byte("log"), true, Forever},
+		{"GCS file that isn't a run's", "https://storage.googleapis.com/test-platform-results/README", []byte("readme"), true, ShortTTL},
+		{"directory listing", job + "/artifacts/", []byte("<html>"), true, ShortTTL},
+		{"finished.json", job + "/finished.json", []byte(`{"passed":false}`), false, Forever},
+		{"finished prowjob.json", job + "/prowjob.json", []byte(`{"status":{"completionTime":"2024-04-21T15:00:00Z"}}`), false, Forever},
+		{"running prowjob.json", job + "/prowjob.json", []byte(`{"status":{"state":"pending"}}`), false, ShortTTL},
+		{"not serving page", job + "/artifacts/junit/junit_e2e.xml", notServingPage, true, 0},
+		{"not serving page as finished.json", job + "/finished.json", notServingPage, false, 0},
+		{"release page", "https://amd64.ocp.releases.ci.openshift.org/releasestream/4.16.0-0.nightly/release/4.16.0-0.nightly-2024-04-21-120000", []byte("<html>"), false, ShortTTL},
+		{"prow page", "https://prow.ci.openshift.org/view/gs/test-platform-results/logs/job/1", []byte("<html>"), true, ShortTTL},
+	}
+	for _, tt := range tests {
+		if got := DefaultPolicy(tt.url, tt.body, tt.finished); got != tt.want {
+			t.Errorf("%s: DefaultPolicy(%s) = %v, want %v", tt.name, tt.url, got, tt.want)
+		}
+	}
+}
+
+// cachedTTL returns whether url is cached and if it expires.
+func cachedTTL(t *testing.T, c *Cache, url string) (cached, expires bool) {
+	t.Helper()
+	_, metaPath := c.paths(url)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return false, false
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	return true, !meta.Expires.IsZero()
+}
+
+func TestCacheFollowsRunState(t *testing.T) {
+	var finishedRequests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/finished.json"):
+			finishedRequests++
+			if strings.Contains(r.URL.Path, "/running/") {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"passed":true}`))
+		case strings.Contains(r.URL.Path, "/not-serving/"):
+			// gcsweb sometimes says so with a 200.
+			w.Write([]byte("<html><p>" + notServing + ".</p></html>"))
+		default:
+			w.Write([]byte("<testsuite/>"))
+		}
+	}))
+	defer srv.Close()
+	cache, err := NewCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testConfig()
+	config.Cache = cache
+	client := New(config)
+	ctx := context.Background()
+	junit := func(job string) string {
+		return srv.URL + "/gcs/test-platform-results/logs/" + job + "/1782000000000000301/artifacts/junit/junit_e2e.xml"
+	}
+	open := func(url string) {
+		t.Helper()
+		body, err := client.Open(ctx, url, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(body)
+		body.Close()
+	}
+
+	// A running job's files can still change.
+	if _, err := client.Get(ctx, junit("running"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if cached, expires := cachedTTL(t, cache, junit("running")); !cached || !expires {
+		t.Errorf("expected the running job's junit to be cached for a while, got cached=%v expires=%v", cached, expires)
+	}
+
+	// A finished one's don't; its finished.json is asked for once (and cached).
+	if _, err := client.Get(ctx, junit("done"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	open(strings.Replace(junit("done"), "junit_e2e.xml", "junit_operator.xml", 1))
+	for _, url := range []string{junit("done"), strings.Replace(junit("done"), "junit_e2e.xml", "junit_operator.xml", 1), srv.URL + "/gcs/test-platform-results/logs/done/1782000000000000301/finished.json"} {
+		if cached, expires := cachedTTL(t, cache, url); !cached || expires {
+			t.Errorf("expected %s to be cached forever, got cached=%v expires=%v", url, cached, expires)
+		}
+	}
+	if finishedRequests != 2 {
+		t.Errorf("expected finished.json to be asked for once per run, got %d requests", finishedRequests)
+	}
+
+	// A streamed not serving page isn't cached even though the run finished.
+	open(junit("not-serving"))
+	if cached, _ := cachedTTL(t, cache, junit("not-serving")); cached {
+		t.Error("expected the streamed not serving page not to be cached")
+	}
+}
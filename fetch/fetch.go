@@ -0,0 +1,344 @@
+// Package fetch is the one HTTP client used by every command.  It checks the HTTP status (a 404
+// is ErrNotFound instead of content), retries 5xx responses (but not gcsweb's "not serving" page) and
+// timeouts with backoff, limits how many requests are in flight and how fast we send them (so we
+// don't hammer prow, gcsweb, sippy or the release controller) and identifies itself with a User-Agent.
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dperique/release-analysis/logging"
+	"golang.org/x/time/rate"
+)
+
+// UserAgent identifies us to the servers we scrape.
+const UserAgent = "release-analysis (+https://github.com/dperique/release-analysis)"
+
+var (
+	// ErrNotFound is returned (wrapped in a StatusError) when the server says 404.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNotServing is returned (wrapped in a StatusError) when gcsweb answers with its 503 "not
+	// serving" page, i.e., the artifact isn't there.
+	ErrNotServing = errors.New("not serving")
+)
+
+// maxErrorBody is how much of an error response we read to tell what it is.
+const maxErrorBody = 64 << 10
+
+// StatusError is returned when the server responds with something other than 200.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	NotServing bool // the body is gcsweb's "not serving" page
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.URL, e.Status)
+}
+
+// Unwrap lets errors.Is(err, ErrNotFound) work for 404s (and ErrNotServing for the not serving page).
+func (e *StatusError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.NotServing:
+		return ErrNotServing
+	}
+	return nil
+}
+
+// Config holds the knobs of a Client.
+type Config struct {
+	MaxConcurrent     int           // requests in flight (a streamed body counts until it's closed)
+	RequestsPerSecond float64       // rate limit when starting requests
+	Burst             int           // requests allowed above the rate limit at once
+	MaxRetries        int           // retries after the first attempt
+	Backoff           time.Duration // wait before the first retry; doubled for each retry after that
+	Transport         http.RoundTripper
+	Cache             *Cache // nil means no caching
+}
+
+// DefaultConfig is what the Default client uses.
+var DefaultConfig = Config{
+	MaxConcurrent:     16,
+	RequestsPerSecond: 20,
+	Burst:             20,
+	MaxRetries:        3,
+	Backoff:           500 * time.Millisecond,
+}
+
+// Client fetches urls; it is safe for concurrent use.
+type Client struct {
+	config  Config
+	client  *http.Client
+	sem     chan struct{}
+	limiter *rate.Limiter
+}
+
+// New returns a client with the given config.
+func New(config Config) *Client {
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = DefaultConfig.MaxConcurrent
+	}
+	if config.RequestsPerSecond <= 0 {
+		config.RequestsPerSecond = DefaultConfig.RequestsPerSecond
+	}
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	return &Client{
+		config:  config,
+		client:  &http.Client{Transport: config.Transport},
+		sem:     make(chan struct{}, config.MaxConcurrent),
+		limiter: rate.NewLimiter(rate.Limit(config.RequestsPerSecond), config.Burst),
+	}
+}
+
+// Default is the client used by the package level functions.
+var Default = New(DefaultConfig)
+
+// Get returns the body of url using the Default client.
+func Get(ctx context.Context, url string, timeout time.Duration) ([]byte, error) {
+	return Default.Get(ctx, url, timeout)
+}
+
+// Open returns a reader for the body of url using the Default client.
+func Open(ctx context.Context, url string, timeout time.Duration) (io.ReadCloser, error) {
+	return Default.Open(ctx, url, timeout)
+}
+
+// Get returns the body of url.  timeout covers each attempt (including reading the body); use ctx
+// to limit (or cancel) all the attempts together.
+func (c *Client) Get(ctx context.Context, url string, timeout time.Duration) ([]byte, error) {
+	if c.config.Cache != nil {
+		if body, ok := c.config.Cache.Get(url); ok {
+			slog.Debug("cache hit", "op", "get", "url", url)
+			return body, nil
+		}
+	}
+	var body []byte
+	err := c.do(ctx, url, timeout, func(resp *http.Response) error {
+		defer resp.Body.Close()
+		var err error
+		body, err = io.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Cache != nil {
+		c.config.Cache.Put(url, body, c.runFinished(ctx, url, timeout, body))
+	}
+	return body, nil
+}
+
+// Open returns a reader for the body of url so it can be streamed (e.g., straight into a decoder).
+// timeout covers the whole download; the caller must close the reader.
+func (c *Client) Open(ctx context.Context, url string, timeout time.Duration) (io.ReadCloser, error) {
+	runFinished := false
+	if c.config.Cache != nil {
+		if body, ok := c.config.Cache.Open(url); ok {
+			slog.Debug("cache hit", "op", "open", "url", url)
+			return body, nil
+		}
+		// Before the body is open since it holds a request slot until it's closed.
+		runFinished = c.runFinished(ctx, url, timeout, nil)
+	}
+	var body io.ReadCloser
+	err := c.do(ctx, url, timeout, func(resp *http.Response) error {
+		body = resp.Body
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Cache != nil {
+		body = c.config.Cache.tee(url, body, runFinished)
+	}
+	return body, nil
+}
+
+// runFinished returns whether the prow job run url is a file of has finished (so its files won't
+// change).  The first time a run comes up, we ask for its finished.json (which is cached like any
+// other file); body is url's body if we have it (a finished.json or completed prowjob.json says so
+// themselves).
+func (c *Client) runFinished(ctx context.Context, url string, timeout time.Duration, body []byte) bool {
+	run, ok := jobRun(url)
+	if !ok {
+		return false
+	}
+	cache := c.config.Cache
+	if isRunState(url) {
+		if body != nil && cache.Policy(url, body, false) == Forever {
+			cache.setRunFinished(run, true)
+		}
+		return false
+	}
+	if finished, known := cache.runFinished(run); known {
+		return finished
+	}
+	finishedBody, err := c.Get(ctx, run+"/finished.json", timeout)
+	finished := err == nil && !bytes.Contains(finishedBody, []byte(notServing))
+	cache.setRunFinished(run, finished)
+	return finished
+}
+
+// EnableCache makes the Default client cache what it fetches in dir.
+func EnableCache(dir string) (*Cache, error) {
+	cache, err := NewCache(dir)
+	if err != nil {
+		return nil, err
+	}
+	config := DefaultConfig
+	config.Cache = cache
+	Default = New(config)
+	return cache, nil
+}
+
+// releaseOnClose releases the request's concurrency slot and timeout when the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// do runs the request (with retries) and calls handle with a 200 response.  The concurrency slot
+// and timeout are held until the body is closed; handle closes it unless it keeps it (i.e., Open).
+func (c *Client) do(ctx context.Context, url string, timeout time.Duration, handle func(*http.Response) error) error {
+	var lastErr error
+	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			wait := c.backoff(attempt)
+			slog.Info("retrying", "url", url, "attempt", attempt+1, "wait", wait, "err", lastErr)
+			if err := sleep(ctx, wait); err != nil {
+				return lastErr
+			}
+		}
+		retry, err := c.attempt(ctx, url, timeout, handle)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	return lastErr
+}
+
+// attempt makes one request and returns whether a failure is worth retrying.
+func (c *Client) attempt(ctx context.Context, url string, timeout time.Duration, handle func(*http.Response) error) (bool, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return false, err
+	}
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	release := func() {
+		cancel()
+		<-c.sem
+	}
+
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, url, nil)
+	if err != nil {
+		release()
+		return false, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		release()
+		slog.Debug("fetch failed", "url", url, logging.Elapsed(start), "err", err)
+		return retryable(ctx, err), err
+	}
+	slog.Debug("fetch", "url", url, "status", resp.StatusCode, logging.Elapsed(start))
+	if resp.StatusCode != http.StatusOK {
+		err := &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			// gcsweb's page for a missing artifact is a 503; asking again won't make it show up.
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+			err.NotServing = bytes.Contains(body, []byte(notServing))
+			retry = !err.NotServing
+		}
+		resp.Body.Close()
+		release()
+		return retry, err
+	}
+
+	wrapped := &releaseOnClose{ReadCloser: resp.Body, release: release}
+	resp.Body = wrapped
+	if err := handle(resp); err != nil {
+		wrapped.Close()
+		return retryable(ctx, err), err
+	}
+	return false, nil
+}
+
+// retryable returns true for timeouts and connection problems (but not if the caller's context is
+// done since then the caller gave up).
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// backoff returns the wait before a retry: Backoff doubled for each retry with some jitter so
+// concurrent requests don't retry in lock step.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.config.Backoff << (attempt - 1)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
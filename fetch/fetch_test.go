@@ -0,0 +1,189 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig retries quickly and doesn't rate limit (unless a test says so).
+func testConfig() Config {
+	return Config{MaxConcurrent: 4, RequestsPerSecond: 1000, Burst: 1000, MaxRetries: 3, Backoff: time.Millisecond}
+}
+
+// statusServer answers with the statuses in order (the last one from then on) and counts the
+// requests.
+func statusServer(t *testing.T, requests *atomic.Int32, statuses ...int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if ua := r.Header.Get("User-Agent"); ua != UserAgent {
+			t.Errorf("unexpected User-Agent %q", ua)
+		}
+		status := statuses[min(n, len(statuses))-1]
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "attempt %d", n)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantBody     string
+		wantStatus   int
+		wantRequests int32
+		wantNotFound bool
+	}{
+		{"ok", []int{200}, "attempt 1", 0, 1, false},
+		{"5xx is retried", []int{500, 502, 200}, "attempt 3", 0, 3, false},
+		{"too many requests is retried", []int{429, 200}, "attempt 2", 0, 2, false},
+		{"retries run out", []int{500}, "", 500, 4, false},
+		{"404 is not retried", []int{404}, "", 404, 1, true},
+		{"4xx is not retried", []int{403}, "", 403, 1, false},
+	}
+	for _, tt := range tests {
+		var requests atomic.Int32
+		srv := statusServer(t, &requests, tt.statuses...)
+		body, err := New(testConfig()).Get(context.Background(), srv.URL, time.Second)
+
+		if requests.Load() != tt.wantRequests {
+			t.Errorf("%s: expected %d requests, got %d", tt.name, tt.wantRequests, requests.Load())
+		}
+		if tt.wantStatus == 0 {
+			if err != nil || string(body) != tt.wantBody {
+				t.Errorf("%s: expected %q, got %q, %v", tt.name, tt.wantBody, body, err)
+			}
+			continue
+		}
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+			t.Errorf("%s: expected a %d StatusError, got %v", tt.name, tt.wantStatus, err)
+		}
+		if errors.Is(err, ErrNotFound) != tt.wantNotFound {
+			t.Errorf("%s: expected errors.Is(err, ErrNotFound) to be %v", tt.name, tt.wantNotFound)
+		}
+	}
+}
+
+func TestNotServing(t *testing.T) {
+	var requests atomic.Int32
+	notServingPage := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if notServingPage {
+			fmt.Fprint(w, "<h1>Application is not available</h1><p>"+notServing+".</p>")
+		} else {
+			fmt.Fprint(w, "upstream connect error")
+		}
+	}))
+	defer srv.Close()
+	client := New(testConfig())
+
+	// gcsweb's page for a missing artifact isn't retried.
+	_, err := client.Get(context.Background(), srv.URL, time.Second)
+	if !errors.Is(err, ErrNotServing) || requests.Load() != 1 {
+		t.Errorf("expected ErrNotServing after 1 request, got %v after %d", err, requests.Load())
+	}
+
+	// Any other 503 is.
+	requests.Store(0)
+	notServingPage = false
+	_, err = client.Get(context.Background(), srv.URL, time.Second)
+	if errors.Is(err, ErrNotServing) || requests.Load() != 4 {
+		t.Errorf("expected a retried 503, got %v after %d requests", err, requests.Load())
+	}
+}
+
+func TestTimeoutIsRetried(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	body, err := New(testConfig()).Get(context.Background(), srv.URL, 50*time.Millisecond)
+	if err != nil || string(body) != "ok" || requests.Load() != 2 {
+		t.Errorf("expected ok on the second request, got %q, %v after %d requests", body, err, requests.Load())
+	}
+}
+
+func TestCanceledContextStopsRetries(t *testing.T) {
+	var requests atomic.Int32
+	srv := statusServer(t, &requests, 500)
+	config := testConfig()
+	config.Backoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := New(config).Get(ctx, srv.URL, time.Second)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || requests.Load() != 1 || time.Since(start) > 5*time.Second {
+		t.Errorf("expected the 500 without waiting for the retry, got %v after %d requests in %s", err, requests.Load(), time.Since(start))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var requests atomic.Int32
+	srv := statusServer(t, &requests, 200)
+	config := testConfig()
+	config.RequestsPerSecond = 50
+	config.Burst = 1
+	client := New(config)
+
+	// The first request goes right away and each one after that waits 20ms.
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if _, err := client.Get(context.Background(), srv.URL, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected 6 requests at 50/s to take at least 100ms, took %s", elapsed)
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	var requests atomic.Int32
+	srv := statusServer(t, &requests, 200)
+	config := testConfig()
+	config.MaxConcurrent = 1
+	client := New(config)
+
+	// A streamed body holds its slot until it's closed.
+	body, err := client.Open(context.Background(), srv.URL, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Get(ctx, srv.URL, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected to wait for the open body, got %v", err)
+	}
+
+	if data, err := io.ReadAll(body); err != nil || string(data) != "attempt 1" {
+		t.Errorf("unexpected streamed body %q, %v", data, err)
+	}
+	body.Close()
+	body.Close()
+	if _, err := client.Get(context.Background(), srv.URL, time.Second); err != nil {
+		t.Errorf("expected the slot to be free once the body is closed, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// recordedResponse is saved (as <key>.json next to <key>.body) for every response we record.
+type recordedResponse struct {
+	URL         string `json:"url"`
+	StatusCode  int    `json:"statusCode"`
+	Status      string `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// recordingPaths returns the meta and body file paths for url in dir.
+func recordingPaths(dir, url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(dir, key+".json"), filepath.Join(dir, key+".body")
+}
+
+// RecordTransport saves every response it gets (whatever the status) in Dir so they can be
+// served back by ReplayTransport.
+type RecordTransport struct {
+	Dir  string
+	Next http.RoundTripper // http.DefaultTransport if nil
+}
+
+// NewRecordTransport returns a RecordTransport that saves responses in dir.
+func NewRecordTransport(dir string) (*RecordTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &RecordTransport{Dir: dir}, nil
+}
+
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	url := req.URL.String()
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(t.Dir, ".tmp-*")
+	if err != nil {
+		return resp, nil
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		tmp:        tmp,
+		dir:        t.Dir,
+		meta: recordedResponse{
+			URL:         url,
+			StatusCode:  resp.StatusCode,
+			Status:      resp.Status,
+			ContentType: resp.Header.Get("Content-Type"),
+		},
+	}
+	return resp, nil
+}
+
+// recordingBody saves the body as it's read; on Close, the rest of the body is read (so the
+// recording is complete even if the caller stopped early) and the recording is saved.
+type recordingBody struct {
+	io.ReadCloser
+	tmp  *os.File
+	dir  string
+	meta recordedResponse
+	once sync.Once
+	err  error
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.err == nil {
+		_, b.err = b.tmp.Write(p[:n])
+	}
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() {
+		if b.err == nil {
+			_, _ = io.Copy(io.Discard, b)
+		}
+		b.tmp.Close()
+		if b.err != nil {
+			os.Remove(b.tmp.Name())
+			return
+		}
+		metaPath, bodyPath := recordingPaths(b.dir, b.meta.URL)
+		if err := os.Rename(b.tmp.Name(), bodyPath); err != nil {
+			os.Remove(b.tmp.Name())
+			return
+		}
+		data, _ := json.MarshalIndent(b.meta, "", "  ")
+		_ = os.WriteFile(metaPath, data, 0644)
+	})
+	return b.ReadCloser.Close()
+}
+
+// ReplayTransport serves the responses saved by RecordTransport; it never uses the network.  A
+// url that wasn't recorded gets a 404.
+type ReplayTransport struct {
+	Dir string
+}
+
+// NewReplayTransport returns a ReplayTransport that serves responses from dir.
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &ReplayTransport{Dir: dir}, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	metaPath, bodyPath := recordingPaths(t.Dir, url)
+	var meta recordedResponse
+	data, err := os.ReadFile(metaPath)
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	var body []byte
+	if err == nil {
+		body, err = os.ReadFile(bodyPath)
+	}
+	if err != nil {
+		meta = recordedResponse{URL: url, StatusCode: http.StatusNotFound, Status: "404 Not Found (not recorded)"}
+		body = []byte(fmt.Sprintf("%s was not recorded\n", url))
+	}
+	resp := &http.Response{
+		Status:        meta.Status,
+		StatusCode:    meta.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	if meta.ContentType != "" {
+		resp.Header.Set("Content-Type", meta.ContentType)
+	}
+	return resp, nil
+}
+
+// UseTransport makes the Default client use transport (e.g., to record or replay) and no cache.
+func UseTransport(transport http.RoundTripper) {
+	config := DefaultConfig
+	config.Transport = transport
+	if _, ok := transport.(*ReplayTransport); ok {
+		// There is no server to be nice to and nothing changes if we try again.
+		config.RequestsPerSecond = float64(rate.Inf)
+		config.MaxRetries = 0
+	}
+	Default = New(config)
+}
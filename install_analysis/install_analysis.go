@@ -0,0 +1,231 @@
+// Package install_analysis classifies install failures.  It scans the installer log
+// (.openshift_install*.log) and the bootstrap gather log bundle (log-bundle-*.tar.gz) of a job run
+// for known signatures (cloud quota, bootstrap timeout, etc.) and keeps the lines that matched.
+// Signatures come from a YAML file so new ones can be added without changing code.
+package install_analysis
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxLinesPerSignature is how many matching lines we keep for each signature.
+	maxLinesPerSignature = 5
+
+	// maxLineLen is how much of a matching line we keep; installer lines can be huge.
+	maxLineLen = 300
+
+	// maxScanLineLen is the longest line we can scan; longer lines end the scan of that file.
+	maxScanLineLen = 1024 * 1024
+)
+
+//go:embed default_signatures.yaml
+var defaultSignaturesYaml []byte
+
+// Signature is a kind of install failure recognized by any of its patterns.
+type Signature struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Patterns    []string `yaml:"patterns"`
+
+	res []*regexp.Regexp
+}
+
+// SignatureSet is the contents of a signatures file.
+type SignatureSet struct {
+	// IncludeDefaults (true if not set) appends the built-in signatures after the ones in the file.
+	IncludeDefaults *bool        `yaml:"includeDefaults"`
+	Signatures      []*Signature `yaml:"signatures"`
+}
+
+// compile checks a signature and compiles its patterns.
+func (s *Signature) compile() error {
+	if s.Name == "" {
+		return fmt.Errorf("signature has no name")
+	}
+	if len(s.Patterns) == 0 {
+		return fmt.Errorf("signature %s has no patterns", s.Name)
+	}
+	s.res = nil
+	for _, pattern := range s.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("signature %s has a bad pattern %q: %w", s.Name, pattern, err)
+		}
+		s.res = append(s.res, re)
+	}
+	return nil
+}
+
+// matches returns true if the line matches any of the signature's patterns.
+func (s *Signature) matches(line string) bool {
+	for _, re := range s.res {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse decodes and compiles a signatures file.
+func parse(data []byte) (*SignatureSet, error) {
+	set := &SignatureSet{}
+	if err := yaml.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	for _, s := range set.Signatures {
+		if err := s.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// Default returns the built-in signatures.
+func Default() *SignatureSet {
+	set, err := parse(defaultSignaturesYaml)
+	if err != nil {
+		// The built-in signatures are part of the binary so this is a programming error.
+		panic(fmt.Sprintf("bad built-in install signatures: %s", err))
+	}
+	return set
+}
+
+// Load reads a signatures file; if path is empty, the built-in signatures are returned.
+func Load(path string) (*SignatureSet, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if set.IncludeDefaults == nil || *set.IncludeDefaults {
+		set.Signatures = append(set.Signatures, Default().Signatures...)
+	}
+	return set, nil
+}
+
+// Register adds a signature (after the ones already in the set).
+func (set *SignatureSet) Register(s *Signature) error {
+	if err := s.compile(); err != nil {
+		return err
+	}
+	set.Signatures = append(set.Signatures, s)
+	return nil
+}
+
+// Line is a log line that matched a signature.
+type Line struct {
+	Source string // the file the line came from (e.g., .openshift_install.log or bootstrap/journals/bootkube.log)
+	Text   string
+}
+
+// Finding is a signature that matched and the lines that matched it.
+type Finding struct {
+	Signature *Signature
+	Count     int    // number of matching lines (we only keep the first few)
+	Lines     []Line // the first maxLinesPerSignature matching lines
+}
+
+// Analysis accumulates the findings of the files scanned for one job run.
+type Analysis struct {
+	set      *SignatureSet
+	findings map[*Signature]*Finding
+}
+
+// NewAnalysis returns an empty analysis using the signatures in the set.
+func (set *SignatureSet) NewAnalysis() *Analysis {
+	return &Analysis{set: set, findings: map[*Signature]*Finding{}}
+}
+
+// ScanLog matches every line of a log file against the signatures.
+func (a *Analysis) ScanLog(source string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxScanLineLen)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, s := range a.set.Signatures {
+			if !s.matches(line) {
+				continue
+			}
+			f, ok := a.findings[s]
+			if !ok {
+				f = &Finding{Signature: s}
+				a.findings[s] = f
+			}
+			f.Count++
+			if len(f.Lines) < maxLinesPerSignature {
+				// Only the kept copy is shortened; the other signatures need the whole line.
+				text := strings.TrimSpace(line)
+				if len(text) > maxLineLen {
+					text = text[:maxLineLen] + "..."
+				}
+				f.Lines = append(f.Lines, Line{Source: source, Text: text})
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// ScanLogBundle scans every file in a bootstrap gather log bundle (a tar file, gzipped or not).
+// A file we can't scan (e.g., a line that is too long) doesn't stop the scan of the others.
+func (a *Analysis) ScanLogBundle(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var tr *tar.Reader
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		tr = tar.NewReader(gz)
+	} else {
+		tr = tar.NewReader(br)
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// The bundle's files all start with log-bundle-<timestamp>/ which is just noise.
+		source := hdr.Name
+		if i := strings.Index(source, "/"); i >= 0 && strings.HasPrefix(source, "log-bundle") {
+			source = source[i+1:]
+		}
+		_ = a.ScanLog(source, tr)
+	}
+}
+
+// Findings returns the signatures that matched in the order of the signature set; the first one
+// is the classification of the failure.
+func (a *Analysis) Findings() []*Finding {
+	findings := []*Finding{}
+	for _, s := range a.set.Signatures {
+		if f, ok := a.findings[s]; ok {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
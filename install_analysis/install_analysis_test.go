@@ -0,0 +1,143 @@
+package install_analysis
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+// findingNames scans log with the built-in signatures and returns the names of the signatures
+// that matched (the first one is the classification).
+func findingNames(t *testing.T, log string) []string {
+	t.Helper()
+	a := Default().NewAnalysis()
+	if err := a.ScanLog(".openshift_install.log", strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range a.Findings() {
+		names = append(names, f.Signature.Name)
+	}
+	return names
+}
+
+func TestDefaultSignatures(t *testing.T) {
+	tests := []struct {
+		class string
+		log   string
+	}{
+		{"cloud-quota", `time="2024-04-21T12:20:10Z" level=error msg="Error: creating EC2 Instance: VcpuLimitExceeded: You have requested more vCPU capacity than your current vCPU limit of 1152 allows"`},
+		{"cloud-quota", `level=error msg=Error: googleapi: Error 403: Quota 'CPUS' exceeded.  Limit: 2400.0 in region us-central1., quotaExceeded`},
+		{"cloud-quota", `level=error msg=Error: creating instance: ZONE_RESOURCE_POOL_EXHAUSTED`},
+		{"cloud-quota", `level=error msg=compute.VirtualMachinesClient#CreateOrUpdate: Code="SkuNotAvailable"`},
+		{"bootstrap-timeout", `level=error msg=Bootstrap failed to complete: timed out waiting for the condition`},
+		{"bootstrap-timeout", `level=info msg=Waiting up to 30m0s for bootstrapping to complete...
+level=error msg=Failed to wait for bootstrapping to complete. This error usually happens when there is a problem with control plane hosts that prevents the control plane operators from creating the control plane.`},
+		{"api-never-came-up", `level=info msg=Waiting up to 20m0s (until 12:40PM) for the Kubernetes API at https://api.ci-op-1234.aws.ci.openshift.org:6443...
+level=error msg=Attempted to gather ClusterOperator status after installation failure: listing ClusterOperator objects: Get "https://api.ci-op-1234.aws.ci.openshift.org:6443/apis/config.openshift.io/v1/clusteroperators": dial tcp: i/o timeout
+level=error msg=Failed waiting for Kubernetes API. This error usually happens when there is a problem on the bootstrap host that prevents creating a temporary control plane.`},
+		{"ingress-not-available", `level=error msg=Cluster operator ingress Available is False with IngressUnavailable: The "default" ingress controller reports Available=False`},
+		{"ingress-not-available", `level=info msg=ingresscontroller "default" is degraded: DeploymentReplicasAllAvailable=False`},
+		{"operators-degraded", `level=error msg=Cluster operator authentication Degraded is True with OAuthServerRouteEndpointAccessibleController_SyncError
+level=error msg=Cluster initialization failed because one or more operators are not functioning properly.`},
+	}
+	for _, tt := range tests {
+		names := findingNames(t, tt.log)
+		if len(names) == 0 || names[0] != tt.class {
+			t.Errorf("expected %s, got %v for:\n%s", tt.class, names, tt.log)
+		}
+	}
+
+	if names := findingNames(t, "level=info msg=Install complete!\nlevel=info msg=Time elapsed: 35m12s\n"); len(names) != 0 {
+		t.Errorf("expected no findings for a good install, got %v", names)
+	}
+}
+
+func TestScanLogLongLines(t *testing.T) {
+	// The quota error is at the start of the line and the API error is past what we keep of it;
+	// both must be found no matter which signature looks at the line first.
+	line := "  level=error msg=LimitExceeded: " + strings.Repeat("x", maxLineLen) + " Failed waiting for Kubernetes API  "
+	a := Default().NewAnalysis()
+	if err := a.ScanLog("bootstrap/journals/bootkube.log", strings.NewReader(line+"\n"+line+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	findings := a.Findings()
+	if len(findings) != 2 || findings[0].Signature.Name != "cloud-quota" || findings[1].Signature.Name != "api-never-came-up" {
+		t.Fatalf("expected cloud-quota and api-never-came-up, got %d findings", len(findings))
+	}
+	for _, f := range findings {
+		if f.Count != 2 || len(f.Lines) != 2 {
+			t.Errorf("%s: expected 2 matching lines, got %d (%d kept)", f.Signature.Name, f.Count, len(f.Lines))
+		}
+		text := f.Lines[0].Text
+		if !strings.HasPrefix(text, "level=error") || !strings.HasSuffix(text, "...") || len(text) != maxLineLen+len("...") {
+			t.Errorf("%s: expected the kept line trimmed and cut to %d characters, got %q", f.Signature.Name, maxLineLen, text)
+		}
+		if f.Lines[0].Source != "bootstrap/journals/bootkube.log" {
+			t.Errorf("%s: unexpected source %q", f.Signature.Name, f.Lines[0].Source)
+		}
+	}
+}
+
+func TestScanLogKeepsFirstLines(t *testing.T) {
+	log := strings.Repeat("level=error msg=Bootstrap failed to complete\n", maxLinesPerSignature+3)
+	a := Default().NewAnalysis()
+	if err := a.ScanLog(".openshift_install.log", strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+	f := a.Findings()[0]
+	if f.Count != maxLinesPerSignature+3 || len(f.Lines) != maxLinesPerSignature {
+		t.Errorf("expected %d matches with %d kept, got %d with %d kept", maxLinesPerSignature+3, maxLinesPerSignature, f.Count, len(f.Lines))
+	}
+}
+
+func TestScanLogBundle(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := map[string]string{
+		"log-bundle-20240421122000/bootstrap/journals/bootkube.log":      "Apr 21 12:40:00 bootkube.sh[2011]: Error: error while checking pod status: timed out waiting for the condition\n",
+		"log-bundle-20240421122000/bootstrap/journals/release-image.log": "Apr 21 12:41:00 Bootstrap failed to complete\n",
+	}
+	for _, name := range []string{"log-bundle-20240421122000/bootstrap/journals/bootkube.log", "log-bundle-20240421122000/bootstrap/journals/release-image.log"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+
+	a := Default().NewAnalysis()
+	if err := a.ScanLogBundle(&buf); err != nil {
+		t.Fatal(err)
+	}
+	findings := a.Findings()
+	if len(findings) != 1 || findings[0].Signature.Name != "bootstrap-timeout" {
+		t.Fatalf("expected bootstrap-timeout, got %d findings", len(findings))
+	}
+	if source := findings[0].Lines[0].Source; source != "bootstrap/journals/release-image.log" {
+		t.Errorf("expected the source without the bundle directory, got %q", source)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	set := Default()
+	if err := set.Register(&Signature{Name: "bad"}); err == nil {
+		t.Error("expected an error for a signature without patterns")
+	}
+	if err := set.Register(&Signature{Name: "dns", Patterns: []string{`no such host`}}); err != nil {
+		t.Fatal(err)
+	}
+	a := set.NewAnalysis()
+	if err := a.ScanLog(".openshift_install.log", strings.NewReader("dial tcp: lookup api.example.com: no such host\n")); err != nil {
+		t.Fatal(err)
+	}
+	if findings := a.Findings(); len(findings) != 1 || findings[0].Signature.Name != "dns" {
+		t.Errorf("expected the registered signature to match, got %d findings", len(findings))
+	}
+}
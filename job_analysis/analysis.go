@@ -1,140 +1,204 @@
 package job_analysis
 
 import (
+	"bytes"
 	"fmt"
-	"regexp"
+	"io"
+	"log/slog"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/dperique/release-analysis/ci_url"
+	"github.com/dperique/release-analysis/install_analysis"
+	"github.com/dperique/release-analysis/logging"
+	"github.com/dperique/release-analysis/ownership"
 	"github.com/dperique/release-analysis/payload_processing"
+	"github.com/dperique/release-analysis/rules"
+	"github.com/dperique/release-analysis/terminal"
 	"github.com/spf13/cobra"
 )
 
 type analysisOptsType struct {
-	url        string
-	addDetails bool
+	urls                  []string
+	urlsFile              string
+	parallel              int
+	addDetails            bool
+	rulesFile             string
+	sigMapFile            string
+	installSignaturesFile string
 }
 
 var analysisOpts analysisOptsType
 
 // Create the analysis command
 var AnalysisCmd = &cobra.Command{
-	Use:   "analysis aUrl",
-	Short: "Analyze a particular payload or prow job",
-	Long:  `View analysis of a payload url or prow job (add more details)...`,
-	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("analysis called")
-		analysisOpts.url = args[0]
-		analysisOpts.Run()
+	Use:   "analysis [aUrl...]",
+	Short: "Analyze payloads or prow jobs",
+	Long:  `View analysis of a payload url, a prow job (periodic or presubmit) or the jobs of a /payload run (add more details)...  Give more than one url (or --file) to analyze them all at the same time and see which tests failed in the most of them.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && analysisOpts.urlsFile == "" {
+			return fmt.Errorf("requires at least 1 url or --file")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// From here on, a failure isn't a usage error.
+		cmd.SilenceUsage = true
+		testRules, err := rules.Load(analysisOpts.rulesFile)
+		if err != nil {
+			return fmt.Errorf("unable to load rules from %s: %w", analysisOpts.rulesFile, err)
+		}
+		payload_processing.TestRules = testRules
+		sigMapping, err := ownership.LoadMapping(analysisOpts.sigMapFile)
+		if err != nil {
+			return fmt.Errorf("unable to load SIG mapping from %s: %w", analysisOpts.sigMapFile, err)
+		}
+		payload_processing.SigMapping = sigMapping
+		installSignatures, err := install_analysis.Load(analysisOpts.installSignaturesFile)
+		if err != nil {
+			return fmt.Errorf("unable to load install signatures from %s: %w", analysisOpts.installSignaturesFile, err)
+		}
+		payload_processing.InstallSignatures = installSignatures
+		analysisOpts.urls = args
+		return analysisOpts.Run()
 	},
 }
 
 func NewAnalysisCmd() *cobra.Command {
 	AnalysisCmd.Flags().BoolVarP(&analysisOpts.addDetails, "add_details", "d", false, "Payload url")
+	AnalysisCmd.Flags().StringVar(&analysisOpts.rulesFile, "rules", "", "YAML file with rules to hide, reclassify or annotate tests (built-in rules by default)")
+	AnalysisCmd.Flags().StringVar(&analysisOpts.sigMapFile, "sig-map", "", "YAML file mapping SIGs to a Jira component and team")
+	AnalysisCmd.Flags().StringVar(&analysisOpts.installSignaturesFile, "install-signatures", "", "YAML file with more install failure signatures (built-in signatures by default)")
+	AnalysisCmd.Flags().StringVar(&analysisOpts.urlsFile, "file", "", "File with more urls to analyze, one per line or in JSON lines (- for stdin)")
+	AnalysisCmd.Flags().IntVar(&analysisOpts.parallel, "parallel", 4, "How many urls to analyze at the same time")
+	AnalysisCmd.Flags().StringVar(&payload_processing.KeepArtifactsDir, "keep-artifacts", "", "Save the raw junit files in this directory (not saved by default)")
 	return AnalysisCmd
 }
 
-func (a *analysisOptsType) Run() {
-	fmt.Println("Run called")
-	fmt.Println("url:", a.url)
-	fmt.Println("addDetails:", a.addDetails)
-
-	shortNamesMap := map[string]string{
-		"aws-sdn-serial":         "aws-sdn-serial",
-		"aws-sdn-upgrade":        "aws-sdn-upgrade",
-		"e2e-aws-sdn-upgrade":    "aws-sdn-upgrade",
-		"e2e-aws-ovn-upgrade":    "aws-ovn-upgrade",
-		"e2e-aws-sdn-serial":     "aws-sdn-serial",
-		"e2e-metal-ipi-ovn-ipv6": "metal-ipi-sdn-bm",
-		"e2e-metal-ipi-sdn-bm":   "metal-ipi-sdn-bm",
-		"e2e-metal-ipi-sdn":      "metal-ipi-sdn",
-		"e2e-gcp-sdn":            "gcp-sdn",
-		//"e2e-alibaba-ovn":               "alibaba-ovn", not supported
-		"aggregated-azure-ovn-upgrade":  "azure-ovn-upgrade",
-		"aggregated-gcp-ovn-rt-upgrade": "gcp-ovn-rt-upgrade",
-		"aggregated-aws-sdn-upgrade":    "aws-sdn-upgrade",
-		"aggregated-aws-ovn-upgrade":    "aws-ovn-upgrade",
-		"aggregated-azure-sdn-upgrade":  "azure-sdn-upgrade",
-		"aggregated-gcp-ovn-upgrade":    "gcp-ovn-upgrade",
+func (a *analysisOptsType) Run() error {
+	slog.Debug("analysis options", "urls", a.urls, "file", a.urlsFile, "addDetails", a.addDetails)
+	urls := a.urls
+	if a.urlsFile != "" {
+		fileUrls, err := readUrlsFile(a.urlsFile)
+		if err != nil {
+			return fmt.Errorf("unable to read the urls from %s: %w", a.urlsFile, err)
+		}
+		urls = append(urls, fileUrls...)
 	}
 
-	// figure out what mode we are in depending on the url
-	mode := "plain"
-	if strings.Contains(a.url, "aggregated") {
-		mode = "aggr"
-	} else if strings.Contains(a.url, "releasestream") {
-		mode = "payload"
+	switch len(urls) {
+	case 0:
+		return fmt.Errorf("no urls of a job run or payload found in %s", a.urlsFile)
+	case 1:
+		a.analyzeUrl(os.Stdout, urls[0])
+	default:
+		a.analyzeAll(os.Stdout, urls)
 	}
-	if mode == "aggr" {
 
-		fmt.Println("Aggregation job")
-
-		// We are in pure aggregated job mode so ignore all the other args.
-		aggrJobUrl := a.url
-
-		// Extract the aggregated job name
-		//re := regexp.MustCompile(`logs/(.*?)-4.(14|13)`)
-		// Branching TODO: We have to add another version for every release
-		re := regexp.MustCompile(`logs/(.*?)-4.(17|16|15|14|13).*?/(\d+)$`)
-
-		match := re.FindStringSubmatch(aggrJobUrl)
-		var aggrJobName string
-		var aggrJobId string
-		if len(match) > 2 {
-			aggrJobName = match[1]
-			aggrJobId = match[3]
-		} else {
-			fmt.Println("No idea what the aggregated job name is")
-			return
-		}
+	// Show what the failures have in common (only collected when printing test detail).
+	payload_processing.PrintFailureSignatures(os.Stdout)
+	return nil
+}
 
-		if shortName, ok := shortNamesMap[aggrJobName]; ok {
-			payload_processing.PrintAggrSummaryTests(aggrJobUrl, true, true, a.addDetails, shortName)
+// analyzeUrl prints the analysis of a url to w and returns the tests that failed.
+func (a *analysisOptsType) analyzeUrl(w io.Writer, url string) []string {
+	start := time.Now()
+	defer func() {
+		slog.Info("analysis done", "url", url, logging.Elapsed(start))
+	}()
+
+	// Figure out what mode we are in depending on what the url refers to.
+	ref, err := ci_url.Resolve(url)
+	if err != nil {
+		slog.Error("unable to analyze the url", "err", err)
+		return nil
+	}
+	return a.analyze(w, ref)
+}
 
-			aggrJobUrlList, err := payload_processing.GetJobRunUrls(aggrJobUrl)
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
-			// Put the aggregated job as the first url for convenience
-			totalJobUrlList := append([]string{aggrJobUrl}, aggrJobUrlList...)
-			fmt.Printf("\"aggr-%s-%s\": [\n", shortName, aggrJobId)
-			len := len(totalJobUrlList)
-			var comma string = ","
-			for i, url := range totalJobUrlList {
-				if i == (len - 1) {
-					comma = ""
-				}
-				fmt.Printf("   \"%s\"%s\n", url, comma)
-			}
-			fmt.Println("],")
-		} else {
-			fmt.Println("Unable to determine short name for aggr job (needed to get a unit tests)")
-			return
+// analyzeAll analyzes the urls (a.parallel at a time) and prints their analysis to w in order,
+// then the tests that failed in the most of them.
+func (a *analysisOptsType) analyzeAll(w io.Writer, urls []string) {
+	// Each url's analysis is kept until it's done so the output isn't mixed up.
+	outputs := make([]bytes.Buffer, len(urls))
+	failures := make([][]string, len(urls))
+	done := make([]chan struct{}, len(urls))
+	for i := range urls {
+		done[i] = make(chan struct{})
+	}
+	go func() {
+		sem := make(chan struct{}, max(a.parallel, 1))
+		for i, url := range urls {
+			sem <- struct{}{}
+			go func(i int, url string) {
+				defer func() { <-sem }()
+				defer close(done[i])
+				failures[i] = a.analyzeUrl(&outputs[i], url)
+			}(i, url)
 		}
+	}()
+
+	for i, url := range urls {
+		<-done[i]
+		fmt.Fprintln(w, terminal.Separator())
+		fmt.Fprintf(w, "[%d/%d] %s\n", i+1, len(urls), terminal.Link(url, url))
+		fmt.Fprintln(w)
+		outputs[i].WriteTo(w)
 	}
-	if mode == "plain" {
+	fmt.Fprintln(w, terminal.Separator())
+	fmt.Fprintf(w, "Analyzed %d urls\n", len(urls))
+	payload_processing.PrintMostFailedTests(w, "urls", failures)
+}
+
+// analyze prints the analysis of what ref refers to (a job run, an aggregated job run, a payload or
+// the jobs of a /payload run) to w and returns the tests that failed.
+func (a *analysisOptsType) analyze(w io.Writer, ref ci_url.JobRef) []string {
+	switch ref.Kind {
+	case ci_url.KindAggregated:
+		fmt.Fprintln(w, "Aggregation job")
 
-		fmt.Println("Plain job")
+		// We are in pure aggregated job mode so ignore all the other args.
+		aggrJobUrl := ref.ProwUrl()
+		aggrJobId := ref.BuildID
 
-		plainJobUrl := a.url
+		// The short name (e.g., aws-ovn-upgrade) is only used to label the list of job runs.
+		shortName := strings.TrimPrefix(payload_processing.JobTarget(aggrJobUrl), "e2e-")
+		if shortName == "" {
+			shortName = ref.JobName
+		}
+		failedTests := payload_processing.PrintAggrSummaryTests(w, aggrJobUrl, true, true, a.addDetails)
 
-		// Extract the job name
-		re := regexp.MustCompile(`-4.(14|13)-(.*?)/\d+$`)
-		match := re.FindStringSubmatch(plainJobUrl)
-		var plainJobName string
-		if len(match) > 1 {
-			plainJobName = match[2]
-		} else {
-			fmt.Println("No idea what the plain job name is")
-			return
+		aggrJobUrlList, err := payload_processing.GetJobRunUrls(w, aggrJobUrl)
+		if err != nil {
+			slog.Error("unable to get the job runs of the aggregated job", "url", aggrJobUrl, "err", err)
+			return failedTests
+		}
+		// Put the aggregated job as the first url for convenience
+		totalJobUrlList := append([]string{aggrJobUrl}, aggrJobUrlList...)
+		fmt.Fprintf(w, "\"aggr-%s-%s\": [\n", shortName, aggrJobId)
+		len := len(totalJobUrlList)
+		var comma string = ","
+		for i, url := range totalJobUrlList {
+			if i == (len - 1) {
+				comma = ""
+			}
+			fmt.Fprintf(w, "   \"%s\"%s\n", url, comma)
 		}
-		fmt.Println(plainJobName)
-		if shortName, ok := shortNamesMap[plainJobName]; ok {
-			payload_processing.PrintPlainSummaryTests(plainJobUrl, shortName, true, a.addDetails, "")
+		fmt.Fprintln(w, "],")
+		return failedTests
+	case ci_url.KindJob:
+		plainJobUrl := ref.ProwUrl()
+		if target := payload_processing.JobTarget(plainJobUrl); target != "" {
+			fmt.Fprintf(w, "Plain job (%s)\n", target)
 		} else {
-			fmt.Println("Unable to determine short name for plain job (needed to get a unit tests)")
-			return
+			fmt.Fprintln(w, "Plain job")
+		}
+
+		// The junit files are found by walking the job's artifacts so we don't need the target.
+		output, failedTests := payload_processing.PrintPlainSummaryTests(w, plainJobUrl, true, a.addDetails, "")
+		for _, line := range output {
+			fmt.Fprint(w, line)
 		}
 		//https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/periodic-ci-openshift-release-master-ci-4.14-e2e-aws-ovn-upgrade/1649404378685116416
 		// periodic-ci-openshift-release-master-ci-4.14-e2e-aws-sdn-serial
@@ -143,12 +207,31 @@ func (a *analysisOptsType) Run() {
 		//   e2e-metal-ipi-ovn-ipv6/baremetalds-e2e-test/
 		// periodic-ci-openshift-release-master-nightly-4.14-e2e-metal-ipi-sdn-bm
 		//   e2e-metal-ipi-sdn-bm/baremetalds-e2e-test/
-	}
-	if mode == "payload" {
-		fmt.Println("Payload item")
+		return failedTests
+	case ci_url.KindPayload:
+		fmt.Fprintln(w, "Payload item")
 		payloadItem := payload_processing.ReleasePayload{
-			ReleaseURL: a.url,
+			ReleaseURL: ref.ReleaseUrl,
+		}
+		return payload_processing.ProcessPayloadItem(w, payloadItem, true, true, false, true, true)
+	case ci_url.KindPayloadRun:
+		fmt.Fprintln(w, "Payload run")
+		jobUrls, err := payload_processing.GetPayloadRunJobs(ref.RunUrl)
+		if err != nil {
+			slog.Error("unable to get the jobs of the payload run", "url", ref.RunUrl, "err", err)
+			return nil
+		}
+		failedTests := []string{}
+		for _, jobUrl := range jobUrls {
+			jobRef, err := ci_url.Resolve(jobUrl)
+			if err != nil {
+				slog.Warn("unable to analyze a job of the payload run", "url", jobUrl, "err", err)
+				continue
+			}
+			fmt.Fprintln(w)
+			failedTests = append(failedTests, a.analyze(w, jobRef)...)
 		}
-		payload_processing.ProcessPayloadItem(payloadItem, true, true, false, true, true)
+		return failedTests
 	}
+	return nil
 }
@@ -0,0 +1,90 @@
+package job_analysis
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dperique/release-analysis/ci_url"
+)
+
+// urlRegex finds the urls in a line of text (or a JSON string).
+var urlRegex = regexp.MustCompile(`(?:https?|gs)://[^\s"'<>\\]+`)
+
+// readUrlsFile returns the urls of job runs and payloads in fileName ("-" means stdin).
+func readUrlsFile(fileName string) ([]string, error) {
+	if fileName == "-" {
+		return readUrls(os.Stdin)
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readUrls(f)
+}
+
+// readUrls returns the urls of job runs and payloads in r, in the order they first show up.  r
+// can have a url per line (blank lines and lines starting with # are skipped), urls mixed in with
+// other text (e.g., pasted from chat) or JSON lines (e.g., a JSONL file) whose strings have urls.
+// Urls that aren't of a job run or payload (see ci_url.Resolve) are skipped.
+func readUrls(r io.Reader) ([]string, error) {
+	urls := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		texts := []string{line}
+		var value any
+		if (line[0] == '{' || line[0] == '[') && json.Unmarshal([]byte(line), &value) == nil {
+			texts = jsonStrings(value, nil)
+		}
+		for _, text := range texts {
+			for _, u := range urlRegex.FindAllString(text, -1) {
+				u = strings.TrimRight(u, ".,;:!?)]}")
+				if seen[u] {
+					continue
+				}
+				seen[u] = true
+				if _, err := ci_url.Resolve(u); err != nil {
+					slog.Debug("skipping url", "err", err)
+					continue
+				}
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls, scanner.Err()
+}
+
+// jsonStrings appends the strings in a decoded JSON value to texts (in the order they are found
+// for arrays; object keys are visited in sorted order).
+func jsonStrings(value any, texts []string) []string {
+	switch v := value.(type) {
+	case string:
+		texts = append(texts, v)
+	case []any:
+		for _, item := range v {
+			texts = jsonStrings(item, texts)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			texts = jsonStrings(v[key], texts)
+		}
+	}
+	return texts
+}
@@ -0,0 +1,77 @@
+package job_history
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/dperique/release-analysis/ci_url"
+	"github.com/dperique/release-analysis/logging"
+	"github.com/dperique/release-analysis/payload_processing"
+	"github.com/dperique/release-analysis/rules"
+	"github.com/spf13/cobra"
+)
+
+type historyOptsType struct {
+	jobName   string
+	runs      int
+	bucket    string
+	rulesFile string
+}
+
+var historyOpts historyOptsType
+
+// Create the job-history command
+var JobHistoryCmd = &cobra.Command{
+	Use:   "job-history jobName",
+	Short: "Show the recent runs of a job and how its pass rate trends",
+	Long:  `View the last --runs runs of a job (from prow's job history) with their result, duration, build farm and failed tests, then the pass rate trend and the tests that failed the most.  jobName can also be the url of one of its runs.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		testRules, err := rules.Load(historyOpts.rulesFile)
+		if err != nil {
+			slog.Error("unable to load rules", "file", historyOpts.rulesFile, "err", err)
+			return
+		}
+		payload_processing.TestRules = testRules
+
+		historyOpts.jobName = args[0]
+		if ref, err := ci_url.Resolve(args[0]); err == nil && ref.JobName != "" {
+			historyOpts.jobName = ref.JobName
+			if !cmd.Flags().Changed("bucket") {
+				historyOpts.bucket = ref.Bucket
+			}
+		}
+		historyOpts.Run()
+	},
+}
+
+func NewJobHistoryCmd() *cobra.Command {
+	JobHistoryCmd.Flags().IntVar(&historyOpts.runs, "runs", 20, "How many of the most recent runs to show")
+	JobHistoryCmd.Flags().StringVar(&historyOpts.bucket, "bucket", ci_url.DefaultBucket, "GCS bucket the job's runs are in")
+	JobHistoryCmd.Flags().StringVar(&historyOpts.rulesFile, "rules", "", "YAML file with rules to hide, reclassify or annotate tests (built-in rules by default)")
+	return JobHistoryCmd
+}
+
+func (h *historyOptsType) Run() {
+	slog.Debug("job-history options", "job", h.jobName, "runs", h.runs, "bucket", h.bucket)
+	start := time.Now()
+	defer func() {
+		slog.Info("job history done", "job", h.jobName, logging.Elapsed(start))
+	}()
+
+	if h.runs < 1 {
+		slog.Error("--runs must be at least 1", "runs", h.runs)
+		return
+	}
+	jobRuns, err := payload_processing.GetJobHistory(h.bucket, h.jobName, h.runs)
+	if err != nil {
+		slog.Error("unable to get the job history", "job", h.jobName, "bucket", h.bucket, "err", err)
+		return
+	}
+	if len(jobRuns) == 0 {
+		slog.Error("the job has no runs", "job", h.jobName, "bucket", h.bucket)
+		return
+	}
+	payload_processing.PrintJobHistory(os.Stdout, h.jobName, jobRuns)
+}
@@ -0,0 +1,336 @@
+// Package junit decodes JUnit xml documents (as written by openshift-tests, ci-operator and
+// friends) into one model no matter if the root is a single <testsuite>, <testsuites> or
+// suites nested in suites.
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Status is the outcome of a single test case attempt.
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusErrored Status = "errored"
+	StatusSkipped Status = "skipped"
+
+	// StatusFlaked is only used for a TestResult; it failed at least once and passed at least once.
+	StatusFlaked Status = "flaked"
+)
+
+// Property is a name/value pair attached to a suite or test case.
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Result holds the details of a <failure>, <error> or <skipped> element.
+type Result struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Content string `xml:",chardata"`
+}
+
+// Text returns the most useful text of the result; the content if there is any, otherwise
+// the message.
+func (r *Result) Text() string {
+	if r == nil {
+		return ""
+	}
+	if strings.TrimSpace(r.Content) != "" {
+		return r.Content
+	}
+	return r.Message
+}
+
+// TestCase is one attempt of a test; a test that was retried shows up as several test cases
+// with the same name.
+type TestCase struct {
+	Name       string
+	Classname  string
+	Time       float64 // seconds
+	Failure    *Result
+	Error      *Result
+	Skipped    *Result
+	Properties []Property
+	SystemOut  string
+	SystemErr  string
+
+	// Suite is the name of the suite the test case belongs to.
+	Suite string
+}
+
+// Status returns the outcome of the test case.
+func (t *TestCase) Status() Status {
+	switch {
+	case t.Failure != nil:
+		return StatusFailed
+	case t.Error != nil:
+		return StatusErrored
+	case t.Skipped != nil:
+		return StatusSkipped
+	default:
+		return StatusPassed
+	}
+}
+
+// Failed returns true if the test case has a <failure> or an <error>.
+func (t *TestCase) Failed() bool {
+	return t.Failure != nil || t.Error != nil
+}
+
+// FailureText returns the failure (or error) output of the test case.
+func (t *TestCase) FailureText() string {
+	if t.Failure != nil {
+		return t.Failure.Text()
+	}
+	return t.Error.Text()
+}
+
+// Suite is a <testsuite>; suites can be nested.
+type Suite struct {
+	Name       string
+	Tests      int
+	Failures   int
+	Errors     int
+	Skipped    int
+	Time       float64 // seconds
+	Properties []Property
+	TestCases  []*TestCase
+	Suites     []*Suite
+	SystemOut  string
+	SystemErr  string
+}
+
+// Suites is the root of a JUnit document.  A document with a single <testsuite> root is
+// represented as Suites with one suite in it.
+type Suites struct {
+	Name   string
+	Suites []*Suite
+}
+
+// TestCases returns every test case in the document; a suite's own test cases come before
+// those of its nested suites.
+func (s *Suites) TestCases() []*TestCase {
+	testCases := []*TestCase{}
+	var walk func(suites []*Suite)
+	walk = func(suites []*Suite) {
+		for _, suite := range suites {
+			testCases = append(testCases, suite.TestCases...)
+			walk(suite.Suites)
+		}
+	}
+	walk(s.Suites)
+	return testCases
+}
+
+// Property returns the value of the first property with the given name in any suite.
+func (s *Suites) Property(name string) (string, bool) {
+	var walk func(suites []*Suite) (string, bool)
+	walk = func(suites []*Suite) (string, bool) {
+		for _, suite := range suites {
+			for _, p := range suite.Properties {
+				if p.Name == name {
+					return p.Value, true
+				}
+			}
+			if v, ok := walk(suite.Suites); ok {
+				return v, true
+			}
+		}
+		return "", false
+	}
+	return walk(s.Suites)
+}
+
+// TestResult summarizes all the attempts of a test (i.e., the test cases with the same name).
+type TestResult struct {
+	Name     string
+	Passes   int
+	Failures int // includes errors
+	Skips    int
+	Cases    []*TestCase
+}
+
+// Attempts returns how many times the test ran (skips don't count).
+func (r *TestResult) Attempts() int {
+	return r.Passes + r.Failures
+}
+
+// Status returns the outcome of the test considering all of its attempts; any pass together
+// with any failure is a flake, failures with no passes is a failure.
+func (r *TestResult) Status() Status {
+	switch {
+	case r.Failures > 0 && r.Passes > 0:
+		return StatusFlaked
+	case r.Failures > 0:
+		return StatusFailed
+	case r.Passes > 0:
+		return StatusPassed
+	default:
+		return StatusSkipped
+	}
+}
+
+// Summarize groups test cases by name and returns one TestResult per test in the order the
+// tests were first seen.
+func Summarize(testCases []*TestCase) []*TestResult {
+	results := []*TestResult{}
+	byName := map[string]*TestResult{}
+	for _, tc := range testCases {
+		r, ok := byName[tc.Name]
+		if !ok {
+			r = &TestResult{Name: tc.Name}
+			byName[tc.Name] = r
+			results = append(results, r)
+		}
+		r.Cases = append(r.Cases, tc)
+		switch tc.Status() {
+		case StatusFailed, StatusErrored:
+			r.Failures++
+		case StatusSkipped:
+			r.Skips++
+		default:
+			r.Passes++
+		}
+	}
+	return results
+}
+
+// seconds is a lenient float attribute; junit writers are not consistent (e.g., time="" or
+// time="1,234.5") and we don't want a bad time to throw away the whole document.
+type seconds float64
+
+func (s *seconds) UnmarshalXMLAttr(attr xml.Attr) error {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(attr.Value), ",", ""), 64)
+	if err == nil {
+		*s = seconds(f)
+	}
+	return nil
+}
+
+// count is a lenient int attribute for the same reason as seconds.
+type count int
+
+func (c *count) UnmarshalXMLAttr(attr xml.Attr) error {
+	i, err := strconv.Atoi(strings.TrimSpace(attr.Value))
+	if err == nil {
+		*c = count(i)
+	}
+	return nil
+}
+
+// These are the shapes we decode; they are converted to the exported model so that callers
+// don't have to care about <properties> vs. bare <property> elements and such.
+type xmlTestCase struct {
+	Name         string     `xml:"name,attr"`
+	Classname    string     `xml:"classname,attr"`
+	Time         seconds    `xml:"time,attr"`
+	Failure      *Result    `xml:"failure"`
+	Error        *Result    `xml:"error"`
+	Skipped      *Result    `xml:"skipped"`
+	Properties   []Property `xml:"properties>property"`
+	BareProperty []Property `xml:"property"`
+	SystemOut    string     `xml:"system-out"`
+	SystemErr    string     `xml:"system-err"`
+}
+
+type xmlSuite struct {
+	Name         string        `xml:"name,attr"`
+	Tests        count         `xml:"tests,attr"`
+	Failures     count         `xml:"failures,attr"`
+	Errors       count         `xml:"errors,attr"`
+	Skipped      count         `xml:"skipped,attr"`
+	Time         seconds       `xml:"time,attr"`
+	Properties   []Property    `xml:"properties>property"`
+	BareProperty []Property    `xml:"property"` // openshift-tests writes these without <properties>
+	TestCases    []xmlTestCase `xml:"testcase"`
+	Suites       []xmlSuite    `xml:"testsuite"`
+	SystemOut    string        `xml:"system-out"`
+	SystemErr    string        `xml:"system-err"`
+}
+
+type xmlSuites struct {
+	Name   string     `xml:"name,attr"`
+	Suites []xmlSuite `xml:"testsuite"`
+}
+
+func (x xmlSuite) toSuite() *Suite {
+	suite := &Suite{
+		Name:       x.Name,
+		Tests:      int(x.Tests),
+		Failures:   int(x.Failures),
+		Errors:     int(x.Errors),
+		Skipped:    int(x.Skipped),
+		Time:       float64(x.Time),
+		Properties: append(x.Properties, x.BareProperty...),
+		SystemOut:  x.SystemOut,
+		SystemErr:  x.SystemErr,
+	}
+	for _, tc := range x.TestCases {
+		suite.TestCases = append(suite.TestCases, &TestCase{
+			Name:       tc.Name,
+			Classname:  tc.Classname,
+			Time:       float64(tc.Time),
+			Failure:    tc.Failure,
+			Error:      tc.Error,
+			Skipped:    tc.Skipped,
+			Properties: append(tc.Properties, tc.BareProperty...),
+			SystemOut:  tc.SystemOut,
+			SystemErr:  tc.SystemErr,
+			Suite:      x.Name,
+		})
+	}
+	for _, nested := range x.Suites {
+		suite.Suites = append(suite.Suites, nested.toSuite())
+	}
+	return suite
+}
+
+// Parse decodes a JUnit document with either a <testsuites> or a <testsuite> root.
+func Parse(r io.Reader) (*Suites, error) {
+	decoder := xml.NewDecoder(r)
+
+	// Peek at the root element to know which shape to decode.
+	var root xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no junit root element found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse junit: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root = start
+			break
+		}
+	}
+
+	switch root.Name.Local {
+	case "testsuites":
+		var x xmlSuites
+		if err := decoder.DecodeElement(&x, &root); err != nil {
+			return nil, fmt.Errorf("unable to parse junit testsuites: %w", err)
+		}
+		suites := &Suites{Name: x.Name}
+		for _, suite := range x.Suites {
+			suites.Suites = append(suites.Suites, suite.toSuite())
+		}
+		return suites, nil
+	case "testsuite":
+		var x xmlSuite
+		if err := decoder.DecodeElement(&x, &root); err != nil {
+			return nil, fmt.Errorf("unable to parse junit testsuite: %w", err)
+		}
+		return &Suites{Name: x.Name, Suites: []*Suite{x.toSuite()}}, nil
+	default:
+		return nil, fmt.Errorf("unexpected junit root element <%s>", root.Name.Local)
+	}
+}
@@ -0,0 +1,178 @@
+package junit
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func parseFile(t *testing.T, name string) *Suites {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	suites, err := Parse(f)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", name, err)
+	}
+	return suites
+}
+
+func TestParseOpenshiftTests(t *testing.T) {
+	suites := parseFile(t, "testdata/openshift-tests.xml")
+
+	if len(suites.Suites) != 1 {
+		t.Fatalf("expected 1 suite, got %d", len(suites.Suites))
+	}
+	suite := suites.Suites[0]
+	if suite.Name != "openshift-tests" || suite.Tests != 5 || suite.Failures != 2 || suite.Skipped != 1 {
+		t.Errorf("unexpected suite attributes: %+v", suite)
+	}
+	if suite.Time != 4123.17 {
+		t.Errorf("expected time 4123.17, got %v", suite.Time)
+	}
+	if v, ok := suites.Property("TestVersion"); !ok || v != "v4.1.0-8001-g3a4ac3b" {
+		t.Errorf("expected TestVersion property, got %q %v", v, ok)
+	}
+
+	testCases := suites.TestCases()
+	if len(testCases) != 5 {
+		t.Fatalf("expected 5 test cases, got %d", len(testCases))
+	}
+	wantStatus := []Status{StatusFailed, StatusPassed, StatusSkipped, StatusFailed, StatusPassed}
+	for i, tc := range testCases {
+		if tc.Status() != wantStatus[i] {
+			t.Errorf("test case %d (%s): expected %s, got %s", i, tc.Name, wantStatus[i], tc.Status())
+		}
+		if tc.Suite != "openshift-tests" {
+			t.Errorf("test case %d: expected suite openshift-tests, got %q", i, tc.Suite)
+		}
+	}
+	if !strings.HasPrefix(testCases[0].FailureText(), "1 failures to create the sandbox\n\nns/e2e-test-1") {
+		t.Errorf("unexpected failure text: %q", testCases[0].FailureText())
+	}
+	if testCases[0].SystemOut != "1 failures to create the sandbox" {
+		t.Errorf("unexpected system-out: %q", testCases[0].SystemOut)
+	}
+	if !strings.Contains(testCases[2].Skipped.Message, "doesn't support ntfs") {
+		t.Errorf("unexpected skip message: %q", testCases[2].Skipped.Message)
+	}
+	if testCases[3].Time != 25.113 {
+		t.Errorf("expected time 25.113, got %v", testCases[3].Time)
+	}
+}
+
+func TestParseCiOperator(t *testing.T) {
+	suites := parseFile(t, "testdata/junit_operator.xml")
+
+	if len(suites.Suites) != 1 || suites.Suites[0].Name != "operator" {
+		t.Fatalf("expected the operator suite, got %+v", suites.Suites)
+	}
+	failed := []*TestCase{}
+	for _, tc := range suites.TestCases() {
+		if tc.Failed() {
+			failed = append(failed, tc)
+		}
+	}
+	if len(failed) != 1 {
+		t.Fatalf("expected 1 failed test case, got %d", len(failed))
+	}
+	if !strings.Contains(failed[0].Name, "ipi-install-install container test") {
+		t.Errorf("unexpected failed test case: %s", failed[0].Name)
+	}
+	if !strings.Contains(failed[0].FailureText(), "Bootstrap failed to complete") {
+		t.Errorf("unexpected failure text: %q", failed[0].FailureText())
+	}
+}
+
+func TestParseNested(t *testing.T) {
+	suites := parseFile(t, "testdata/nested.xml")
+
+	if suites.Name != "all" || len(suites.Suites) != 1 {
+		t.Fatalf("unexpected root: %+v", suites)
+	}
+	outer := suites.Suites[0]
+	if len(outer.Suites) != 1 || outer.Suites[0].Name != "inner" {
+		t.Fatalf("expected a nested inner suite, got %+v", outer.Suites)
+	}
+	if outer.Time != 0 {
+		t.Errorf("expected an empty time to be 0, got %v", outer.Time)
+	}
+	if v, ok := suites.Property("cluster"); !ok || v != "build05" {
+		t.Errorf("expected cluster property, got %q %v", v, ok)
+	}
+
+	testCases := suites.TestCases()
+	names := []string{}
+	for _, tc := range testCases {
+		names = append(names, tc.Name)
+	}
+	if strings.Join(names, ",") != "outer passes,inner passes,inner errors" {
+		t.Errorf("unexpected test case order: %v", names)
+	}
+	errored := testCases[2]
+	if errored.Status() != StatusErrored || !errored.Failed() {
+		t.Errorf("expected inner errors to be errored, got %s", errored.Status())
+	}
+	if errored.Error.Type != "panic" || errored.FailureText() != "goroutine 1 [running]" {
+		t.Errorf("unexpected error: %+v", errored.Error)
+	}
+	if errored.SystemErr != "stack trace here" || errored.Suite != "inner" {
+		t.Errorf("unexpected test case: %+v", errored)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, doc := range map[string]string{
+		"empty":        "",
+		"not junit":    "<html><body>NOT_SERVING</body></html>",
+		"not xml":      "The application is currently not serving requests at this endpoint.",
+		"unterminated": "<testsuite name=\"x\"><testcase name=\"a\">",
+	} {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	failure := &Result{Message: "boom"}
+	testCases := []*TestCase{
+		{Name: "passes then fails"},
+		{Name: "fails three times", Failure: failure},
+		{Name: "flakes on third attempt", Failure: failure},
+		{Name: "fails three times", Failure: failure},
+		{Name: "flakes on third attempt", Error: failure},
+		{Name: "fails three times", Failure: failure},
+		{Name: "flakes on third attempt"},
+		{Name: "skipped", Skipped: &Result{}},
+		{Name: "passes then fails", Failure: failure},
+	}
+	want := map[string]struct {
+		status   Status
+		attempts int
+		failures int
+	}{
+		"passes then fails":       {StatusFlaked, 2, 1},
+		"fails three times":       {StatusFailed, 3, 3},
+		"flakes on third attempt": {StatusFlaked, 3, 2},
+		"skipped":                 {StatusSkipped, 0, 0},
+	}
+
+	results := Summarize(testCases)
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(results))
+	}
+	if results[0].Name != "passes then fails" || results[3].Name != "skipped" {
+		t.Errorf("expected results in first seen order, got %s ... %s", results[0].Name, results[3].Name)
+	}
+	for _, r := range results {
+		w := want[r.Name]
+		if r.Status() != w.status || r.Attempts() != w.attempts || r.Failures != w.failures {
+			t.Errorf("%s: expected %s with %d/%d failed attempts, got %s with %d/%d",
+				r.Name, w.status, w.failures, w.attempts, r.Status(), r.Failures, r.Attempts())
+		}
+	}
+}
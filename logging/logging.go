@@ -0,0 +1,40 @@
+// Package logging sets up the diagnostic logger (log/slog).  Diagnostics (what was downloaded,
+// what failed and how long it took) go to stderr so stdout only has the analysis.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// DefaultLevel only shows problems; -v (or --log-level=debug) shows every download.
+const DefaultLevel = "warn"
+
+// Setup makes the default slog logger write to w at level (debug, info, warn or error) in format
+// (text or json).
+func Setup(w io.Writer, level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("bad log level %q (use debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text", "":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("bad log format %q (use text or json)", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Elapsed returns the time since start as a log attribute (rounded so it's easy to read).
+func Elapsed(start time.Time) slog.Attr {
+	return slog.Duration("elapsed", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,148 @@
+// Package ownership figures out who to ping for a failing test.  openshift-tests names carry
+// tags like [sig-network] and [Jira:"Networking / ovn-kubernetes"]; an optional mapping file
+// maps SIGs (and Jira components) to a Jira component and team.
+package ownership
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NoSig is used for tests without a [sig-xxx] tag (e.g., ci-operator step failures).
+const NoSig = "other"
+
+var (
+	sigRegex  = regexp.MustCompile(`\[(sig-[a-zA-Z0-9_-]+)\]`)
+	jiraRegex = regexp.MustCompile(`\[Jira:\s*"?([^"\]]+)"?\]`)
+)
+
+// Owner is a Jira component and team.
+type Owner struct {
+	Component string `yaml:"component"`
+	Team      string `yaml:"team"`
+}
+
+// Mapping is the contents of a mapping file, e.g.:
+//
+//	sigs:
+//	  sig-network:
+//	    component: Networking / ovn-kubernetes
+//	    team: SDN
+//	components:
+//	  "Networking / router":
+//	    team: NetEdge
+type Mapping struct {
+	Sigs       map[string]Owner `yaml:"sigs"`
+	Components map[string]Owner `yaml:"components"`
+}
+
+// LoadMapping reads a mapping file; if path is empty, an empty mapping is returned so that
+// tests are still grouped by the tags in their names.
+func LoadMapping(path string) (*Mapping, error) {
+	m := &Mapping{}
+	if path == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseTestName returns the SIG (NoSig if none) and the Jira component (if any) from the tags
+// in a test name.
+func ParseTestName(testName string) (string, string) {
+	sig := NoSig
+	if m := sigRegex.FindStringSubmatch(testName); len(m) > 1 {
+		sig = m[1]
+	}
+	component := ""
+	if m := jiraRegex.FindStringSubmatch(testName); len(m) > 1 {
+		component = strings.TrimSpace(m[1])
+	}
+	return sig, component
+}
+
+// Owner returns the SIG of a test and its owner; the Jira tag in the test name wins over the
+// component mapped from the SIG.
+func (m *Mapping) Owner(testName string) (string, Owner) {
+	sig, component := ParseTestName(testName)
+	owner := Owner{}
+	if m != nil {
+		owner = m.Sigs[sig]
+	}
+	if component != "" {
+		owner.Component = component
+		if m != nil {
+			if compOwner, ok := m.Components[component]; ok && compOwner.Team != "" {
+				owner.Team = compOwner.Team
+			}
+		}
+	}
+	return sig, owner
+}
+
+// Group is the failing tests of one SIG.
+type Group struct {
+	Sig        string
+	Tests      []string
+	Components []string // distinct components and teams, e.g., "Networking / ovn-kubernetes (SDN)"
+}
+
+// GroupTests groups test names by SIG; the biggest groups come first.
+func (m *Mapping) GroupTests(testNames []string) []*Group {
+	bySig := map[string]*Group{}
+	seenComponent := map[string]bool{}
+	groups := []*Group{}
+	for _, testName := range testNames {
+		sig, owner := m.Owner(testName)
+		g, ok := bySig[sig]
+		if !ok {
+			g = &Group{Sig: sig}
+			bySig[sig] = g
+			groups = append(groups, g)
+		}
+		g.Tests = append(g.Tests, testName)
+
+		componentStr := owner.Component
+		if owner.Team != "" {
+			if componentStr == "" {
+				componentStr = "team " + owner.Team
+			} else {
+				componentStr += " (" + owner.Team + ")"
+			}
+		}
+		if componentStr != "" && !seenComponent[sig+componentStr] {
+			seenComponent[sig+componentStr] = true
+			g.Components = append(g.Components, componentStr)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Tests) > len(groups[j].Tests)
+	})
+	return groups
+}
+
+// Summary returns a one line summary like "5 failures: 3 sig-network, 2 sig-storage".
+func Summary(groups []*Group) string {
+	total := 0
+	parts := []string{}
+	for _, g := range groups {
+		total += len(g.Tests)
+		parts = append(parts, fmt.Sprintf("%d %s", len(g.Tests), g.Sig))
+	}
+	noun := "failures"
+	if total == 1 {
+		noun = "failure"
+	}
+	return fmt.Sprintf("%d %s: %s", total, noun, strings.Join(parts, ", "))
+}
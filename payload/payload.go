@@ -2,47 +2,64 @@ package payload
 
 import (
 	"fmt"
+	"log/slog"
+	"os"
+	"time"
 
+	"github.com/dperique/release-analysis/config"
+	"github.com/dperique/release-analysis/install_analysis"
+	"github.com/dperique/release-analysis/logging"
+	"github.com/dperique/release-analysis/ownership"
 	"github.com/dperique/release-analysis/payload_processing"
+	"github.com/dperique/release-analysis/rules"
 	"github.com/spf13/cobra"
 )
 
 type payloadOptsType struct {
-	version              string
-	stream               string
-	showAllUrl           bool
-	showAllUrlStr        string
-	showAggrTimes        bool
-	showAggrTimesStr     string
-	showSuccess          bool
-	showSuccessStr       string
-	dbMode               string
-	payload_getter       payload_processing.PayloadGetter
-	printTestDetail      bool
-	printTestDetailStr   string
-	showAggrJobDetail    bool
-	showAggrJobDetailStr string
+	version               string
+	stream                string
+	showAllUrl            bool
+	showAllUrlStr         string
+	showAggrTimes         bool
+	showAggrTimesStr      string
+	showSuccess           bool
+	showSuccessStr        string
+	dbMode                string
+	payload_getter        payload_processing.PayloadGetter
+	printTestDetail       bool
+	printTestDetailStr    string
+	showAggrJobDetail     bool
+	showAggrJobDetailStr  string
+	rulesFile             string
+	sigMapFile            string
+	installSignaturesFile string
 }
 
 var payloadOpts payloadOptsType
 
 // Create the payload command
 var PayloadCmd = &cobra.Command{
-	Use:   "payload aVersion aStream",
+	Use:   "payload [aVersion [aStream]]",
 	Short: "View payload of release-controller given a Version (e.g., 4.15, 4.16) and a Stream (e.g., nightly, ci)",
-	Long:  `View payload of release-controller given a Version (e.g., 4.15, 4.16) and a Stream (e.g., nightly, ci)`,
-	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		version := args[0]
+	Long:  `View payload of release-controller given a Version (e.g., 4.15, 4.16) and a Stream (e.g., nightly, ci); they default to the version and stream settings (see 'config view')`,
+	Args:  cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version := config.Current.Version
+		if len(args) > 0 {
+			version = args[0]
+		}
 		if version != "4.13" && version != "4.14" && version != "4.15" && version != "4.16" && version != "4.17" {
 			fmt.Println("Invalid version. Version must be between 4.13 and 4.16.")
-			return
+			return nil
 		}
 		payloadOpts.version = version
-		stream := args[1]
+		stream := config.Current.Stream
+		if len(args) > 1 {
+			stream = args[1]
+		}
 		if stream != "nightly" && stream != "ci" {
 			fmt.Println("Invalid stream. Stream must be either 'nightly' or 'ci'.")
-			return
+			return nil
 		}
 		payloadOpts.stream = stream
 
@@ -54,28 +71,46 @@ var PayloadCmd = &cobra.Command{
 		if payloadOpts.showAggrTimesStr == "false" {
 			payloadOpts.showAggrTimes = false
 		}
+		payloadOpts.showSuccess = false
 		if payloadOpts.showSuccessStr == "true" {
 			payloadOpts.showSuccess = true
 		}
+		payloadOpts.printTestDetail = false
 		if payloadOpts.printTestDetailStr == "true" {
 			payloadOpts.printTestDetail = true
 		}
+		payloadOpts.showAggrJobDetail = false
 		if payloadOpts.showAggrJobDetailStr == "true" {
 			payloadOpts.showAggrJobDetail = true
 		}
 
-		switch payloadOpts.dbMode {
-		case "rcWebpage":
-			payloadOpts.payload_getter = payload_processing.RcWebpagePayloadGetter{}
-		case "sippyDB":
-			payloadOpts.payload_getter = payload_processing.SippyDBPayloadGetter{}
-		case "rcAPI":
-			payloadOpts.payload_getter = payload_processing.RcAPIPayloadGetter{}
-		default:
-			fmt.Println("Unknown dbMode; defaulting to rcWebpage")
-			payloadOpts.payload_getter = payload_processing.RcWebpagePayloadGetter{}
+		// From here on, a failure isn't a usage error.
+		cmd.SilenceUsage = true
+		testRules, err := rules.Load(payloadOpts.rulesFile)
+		if err != nil {
+			return fmt.Errorf("unable to load rules from %s: %w", payloadOpts.rulesFile, err)
+		}
+		payload_processing.TestRules = testRules
+		sigMapping, err := ownership.LoadMapping(payloadOpts.sigMapFile)
+		if err != nil {
+			return fmt.Errorf("unable to load SIG mapping from %s: %w", payloadOpts.sigMapFile, err)
+		}
+		payload_processing.SigMapping = sigMapping
+		installSignatures, err := install_analysis.Load(payloadOpts.installSignaturesFile)
+		if err != nil {
+			return fmt.Errorf("unable to load install signatures from %s: %w", payloadOpts.installSignaturesFile, err)
+		}
+		payload_processing.InstallSignatures = installSignatures
+
+		if !cmd.Flags().Changed("dbMode") {
+			payloadOpts.dbMode = config.Current.DbMode
 		}
-		payloadOpts.Run()
+		var known bool
+		payloadOpts.payload_getter, known = payload_processing.NewPayloadGetter(payloadOpts.dbMode)
+		if !known {
+			slog.Warn("unknown dbMode; defaulting to rcWebpage", "dbMode", payloadOpts.dbMode)
+		}
+		return payloadOpts.Run()
 	},
 }
 
@@ -83,36 +118,41 @@ func NewPayloadCmd() *cobra.Command {
 	PayloadCmd.Flags().StringVarP(&payloadOpts.showAllUrlStr, "showAllUrl", "a", "true", "Show all url (suppress passing payload urls by default))")
 	PayloadCmd.Flags().StringVarP(&payloadOpts.showAggrTimesStr, "showAggrTimes", "s", "true", "Show duration for underlying prowjobs for aggregated jobs")
 	PayloadCmd.Flags().StringVarP(&payloadOpts.showSuccessStr, "showSuccess", "c", "false", "Show jobs even though they were successful (show only failed jobs by default)")
-	PayloadCmd.Flags().StringVarP(&payloadOpts.dbMode, "dbMode", "d", "rcWebpage", "DB mode (rcWebpage (default), sippyDB, rcAPI)")
+	PayloadCmd.Flags().StringVarP(&payloadOpts.dbMode, "dbMode", "d", "", "DB mode (rcWebpage, sippyDB, rcAPI); defaults to the db-mode setting")
 	PayloadCmd.Flags().StringVarP(&payloadOpts.printTestDetailStr, "printTestDetail", "t", "false", "Print test detail")
 	PayloadCmd.Flags().StringVarP(&payloadOpts.showAggrJobDetailStr, "showAggrJobDetail", "j", "false", "Show aggregated job detail")
+	PayloadCmd.Flags().StringVar(&payloadOpts.rulesFile, "rules", "", "YAML file with rules to hide, reclassify or annotate tests (built-in rules by default)")
+	PayloadCmd.Flags().StringVar(&payloadOpts.sigMapFile, "sig-map", "", "YAML file mapping SIGs to a Jira component and team")
+	PayloadCmd.Flags().StringVar(&payloadOpts.installSignaturesFile, "install-signatures", "", "YAML file with more install failure signatures (built-in signatures by default)")
+	PayloadCmd.Flags().StringVar(&payload_processing.KeepArtifactsDir, "keep-artifacts", "", "Save the raw junit files in this directory (not saved by default)")
 	return PayloadCmd
 }
 
-func (o *payloadOptsType) Run() {
-	fmt.Println("Run called")
-	fmt.Println("version:", o.version)
-	fmt.Println("stream:", o.stream)
-	fmt.Println("showAllUrl:", o.showAllUrl)
-	fmt.Println("showAggrTimes:", o.showAggrTimes)
-	fmt.Println("showSuccess:", o.showSuccess)
-	fmt.Println("dbMode:", o.dbMode)
-	fmt.Println("printTestDetail:", o.printTestDetail)
-	fmt.Println("showAggrJobDetail:", o.showAggrJobDetail)
-
-	defer fmt.Println("Finished listing the payloads")
-
-	for i := 0; i < 12; i++ {
-		fmt.Println()
-	}
+func (o *payloadOptsType) Run() error {
+	slog.Debug("payload options", "version", o.version, "stream", o.stream, "showAllUrl", o.showAllUrl,
+		"showAggrTimes", o.showAggrTimes, "showSuccess", o.showSuccess, "dbMode", o.dbMode,
+		"printTestDetail", o.printTestDetail, "showAggrJobDetail", o.showAggrJobDetail)
+	start := time.Now()
+	defer func() {
+		fmt.Println("Finished listing the payloads")
+		slog.Info("payload done", "version", o.version, "stream", o.stream, logging.Elapsed(start))
+	}()
 
 	// Contruct the url for the the requested payload for easy access.
 	payload_url := fmt.Sprintf("https://amd64.ocp.releases.ci.openshift.org/#%s.0-0.%s", o.version, o.stream)
 	fmt.Printf("Getting: %s %s, %s\n", o.version, o.stream, payload_url)
 
-	payloadItems := payload_processing.GetPayloadItems(o.version, o.stream, payloadOpts.payload_getter)
+	payloadItems, err := payload_processing.GetPayloadItems(o.version, o.stream, payloadOpts.payload_getter)
+	if err != nil {
+		payload_processing.PrintListError(os.Stdout, payload_url, err)
+		return fmt.Errorf("unable to list the %s %s payloads: %w", o.version, o.stream, err)
+	}
 
 	for _, payloadItem := range payloadItems {
-		payload_processing.ProcessPayloadItem(payloadItem, o.showAllUrl, o.showAggrTimes, o.showSuccess, o.printTestDetail, o.showAggrJobDetail)
+		payload_processing.ProcessPayloadItem(os.Stdout, payloadItem, o.showAllUrl, o.showAggrTimes, o.showSuccess, o.printTestDetail, o.showAggrJobDetail)
 	}
+
+	// With printTestDetail, failures were grouped by signature across all the payloads.
+	payload_processing.PrintFailureSignatures(os.Stdout)
+	return nil
 }
@@ -0,0 +1,94 @@
+package payload_processing
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// correlationTestWidth is how much of the test name we show in the correlation table.
+const correlationTestWidth = 110
+
+// printAggrCorrelation prints a test name x aggregated job table for a payload so we can see
+// which tests failed on more than one aggregated job.  Those are marked with a '*' (and in red)
+// because a test failing across platforms points at a product regression rather than cloud
+// specific noise.
+// aggrResults maps the aggregated job short name to the failing tests we scraped for it.
+func printAggrCorrelation(w io.Writer, aggrResults map[string][]aggrTestResult) {
+	if len(aggrResults) < 2 {
+		// Nothing to correlate.
+		return
+	}
+
+	jobNames := make([]string, 0, len(aggrResults))
+	for jobName := range aggrResults {
+		jobNames = append(jobNames, jobName)
+	}
+	sort.Strings(jobNames)
+
+	// testName -> jobName -> result
+	table := map[string]map[string]aggrTestResult{}
+	for jobName, results := range aggrResults {
+		for _, r := range results {
+			if table[r.name] == nil {
+				table[r.name] = map[string]aggrTestResult{}
+			}
+			table[r.name][jobName] = r
+		}
+	}
+	if len(table) == 0 {
+		return
+	}
+
+	// Most widespread failures first, then by name so the output is stable.
+	testNames := make([]string, 0, len(table))
+	for testName := range table {
+		testNames = append(testNames, testName)
+	}
+	sort.Slice(testNames, func(i, j int) bool {
+		if len(table[testNames[i]]) != len(table[testNames[j]]) {
+			return len(table[testNames[i]]) > len(table[testNames[j]])
+		}
+		return testNames[i] < testNames[j]
+	})
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  Aggregated test correlation (pass/fail per aggregated job, '-' means it did not fail there, '*' means it failed on more than one):")
+	for i, jobName := range jobNames {
+		fmt.Fprintf(w, "    [%d] %s\n", i+1, jobName)
+	}
+	header := fmt.Sprintf("    %-*s", correlationTestWidth, "test")
+	for i := range jobNames {
+		header += fmt.Sprintf(" %7s", fmt.Sprintf("[%d]", i+1))
+	}
+	fmt.Fprintln(w, header)
+
+	multiCount := 0
+	for _, testName := range testNames {
+		name := testName
+		if len(name) > correlationTestWidth {
+			name = name[:correlationTestWidth]
+		}
+		marker := " "
+		if len(table[testName]) > 1 {
+			marker = "*"
+		}
+		row := fmt.Sprintf("  %s %-*s", marker, correlationTestWidth, name)
+		for _, jobName := range jobNames {
+			cell := "-"
+			if r, ok := table[testName][jobName]; ok {
+				cell = fmt.Sprintf("%d/%d", r.passed, r.failed)
+			}
+			row += fmt.Sprintf(" %7s", cell)
+		}
+		if len(table[testName]) > 1 {
+			multiCount++
+			row = red + row + colorNone
+		}
+		fmt.Fprintln(w, row)
+	}
+	if multiCount > 0 {
+		fmt.Fprintf(w, "  %s%d test(s) failed on more than one aggregated job; suspect a product regression%s\n", red, multiCount, colorNone)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,95 @@
+package payload_processing
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dperique/release-analysis/terminal"
+)
+
+// aggrTestResult holds what we could scrape from aggregation-testrun-summary.html for one failing
+// test so we don't have to do the pass/fail/req arithmetic in our heads.
+type aggrTestResult struct {
+	name           string // the whole name; it is only shortened when printed
+	passed         int
+	failed         int
+	requiredPasses int  // 0 means the summary line did not tell us
+	disruption     bool // disruption tests are colored (and counted) differently
+}
+
+// passesNeeded returns how many more passes the test needed to make the aggregated job pass.
+// The second return value is false if we can't tell (e.g., the disruption summaries or the
+// "not enough attempts" summary which is about attempts and not passes).
+func (r aggrTestResult) passesNeeded() (int, bool) {
+	if r.requiredPasses == 0 {
+		return 0, false
+	}
+	needed := r.requiredPasses - r.passed
+	if needed < 0 {
+		needed = 0
+	}
+	return needed, true
+}
+
+// isOneFlakeAway returns true if every failing test was within one pass of its requirement;
+// this is when a retry of the aggregated job is most likely worth it.
+// truncated means we stopped scraping early (more than MAX_TESTS) so we can't say.
+func isOneFlakeAway(results []aggrTestResult, truncated bool) bool {
+	if len(results) == 0 || truncated {
+		return false
+	}
+	for _, r := range results {
+		needed, ok := r.passesNeeded()
+		if !ok || needed > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// printDistanceToPass prints the failing tests ranked by how close they were to passing
+// (closest first); tests where we can't tell are listed last with a "?".
+func printDistanceToPass(w io.Writer, results []aggrTestResult, truncated bool) {
+	if len(results) == 0 {
+		return
+	}
+	ranked := make([]aggrTestResult, len(results))
+	copy(ranked, results)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		ni, oki := ranked[i].passesNeeded()
+		nj, okj := ranked[j].passesNeeded()
+		if oki != okj {
+			return oki
+		}
+		return ni < nj
+	})
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "    Distance to pass (more passes needed, closest first):")
+	for _, r := range ranked {
+		neededStr := "?"
+		if needed, ok := r.passesNeeded(); ok {
+			neededStr = fmt.Sprintf("%d", needed)
+		}
+		reqStr := "?"
+		if r.requiredPasses > 0 {
+			reqStr = fmt.Sprintf("%d", r.requiredPasses)
+		}
+		color := purple
+		if r.disruption {
+			color = orange
+		}
+		// Like the failed tests above, the name is only cut when we don't know the terminal's width.
+		name := r.name
+		if terminal.Width == 0 && len(name) > MAX_CHAR {
+			name = name[:MAX_CHAR]
+		}
+		line := fmt.Sprintf("      %3s  %spass=%d/req=%s %s%s", neededStr, color, r.passed, reqStr, name, colorNone)
+		fmt.Fprintln(w, terminal.Wrap(line, "                "))
+	}
+	if isOneFlakeAway(results, truncated) {
+		fmt.Fprintf(w, "    %sOne flake away: every failing test was within one pass of the requirement (a retry is worth it)%s\n", green, colorNone)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,134 @@
+package payload_processing
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PayloadHealth is what the metrics exporter shows for a payload: the state of its blocking jobs
+// and, for the failed aggregated ones, what failed.
+type PayloadHealth struct {
+	Name         string // e.g., 4.16.0-0.nightly-2024-04-21-120000
+	Phase        string // Accepted, Rejected, Ready, ...
+	BlockingJobs []BlockingJobHealth
+}
+
+// BlockingJobHealth is a blocking job of a payload.  Only failed aggregated jobs have test
+// failures and disruption.
+type BlockingJobHealth struct {
+	Name         string         // e.g., aggregated-aws-ovn-upgrade-4.16-micro
+	Url          string         // the prow job
+	Status       string         // Pending, Succeeded or Failed
+	TestFailures map[string]int // failed test -> how many of the job runs it failed in
+
+	// Disruption is the disruption of each backend that failed, e.g., the mean disruption of
+	// openshift-api-new-connections or the P95 of ingress-to-oauth-server.
+	Disruption []Disruption
+}
+
+// Disruption is one statistic ("mean" or "P95") of the disruption of a backend.
+type Disruption struct {
+	Backend   string
+	Statistic string
+	Seconds   float64
+}
+
+var (
+	payloadTimeRegex       = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}-\d{6})$`)
+	disruptionBackendRegex = regexp.MustCompile(`testCase=\[disruption/([^\]]+)\]`)
+)
+
+// Name returns the payload's tag, e.g., 4.16.0-0.nightly-2024-04-21-120000.
+func (p ReleasePayload) Name() string {
+	return path.Base(p.ReleaseURL)
+}
+
+// Phase returns Accepted, Rejected, Ready, ...
+func (p ReleasePayload) Phase() string {
+	return p.phase
+}
+
+// Time returns when the payload was created (from its name); false if the name has no time.
+func (p ReleasePayload) Time() (time.Time, bool) {
+	m := payloadTimeRegex.FindStringSubmatch(p.Name())
+	if len(m) < 2 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02-150405", m[1])
+	return t, err == nil
+}
+
+// GetPayloadHealth scrapes the payload's release page for its blocking jobs and the summaries of
+// the failed aggregated ones.  It only fails if the release page can't be used; a job whose
+// summary can't be downloaded is logged and shown without failures.
+func GetPayloadHealth(p ReleasePayload) (PayloadHealth, error) {
+	health := PayloadHealth{Name: p.Name(), Phase: p.phase}
+	start := time.Now()
+	body, err := getBodyTimeout(p.ReleaseURL, BODY_TIMEOUT*10)
+	if err != nil {
+		logDownloadError("GetPayloadHealth", p.ReleaseURL, start, err)
+		return health, err
+	}
+	jobs, found := getBlockingJobs(string(body))
+	if !found {
+		return health, fmt.Errorf("%s: no blocking jobs found", p.ReleaseURL)
+	}
+	for _, job := range jobs {
+		jobHealth := BlockingJobHealth{Name: job.name, Url: job.url, Status: job.status}
+		if job.status == "Failed" && strings.HasPrefix(job.name, "aggregated") {
+			summaryUrl := getSummaryUrl(job.url)
+			start := time.Now()
+			summary, err := getBodyTimeout(summaryUrl, BODY_TIMEOUT)
+			if err == nil && strings.Contains(string(summary), NOT_SERVING) {
+				err = errNotServing
+			}
+			if err != nil {
+				logDownloadError("GetPayloadHealth", summaryUrl, start, err)
+			} else {
+				jobHealth.TestFailures, jobHealth.Disruption = parseAggrSummary(string(summary))
+			}
+		}
+		health.BlockingJobs = append(health.BlockingJobs, jobHealth)
+	}
+	return health, nil
+}
+
+// parseAggrSummary returns the failed tests in an aggregation-testrun-summary.html (with how
+// many times they failed if the summary says; without the ones the rules hide) and the disruption
+// of the backends that failed.
+func parseAggrSummary(body string) (map[string]int, []Disruption) {
+	failures := map[string]int{}
+	disruption := []Disruption{}
+	lines := strings.Split(body, "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "Failed: ") {
+			continue
+		}
+		name := strings.TrimPrefix(lines[i], "Failed: ")
+		name = strings.Replace(strings.Replace(name, "<b>", "", 1), "</b>", "", 1)
+		summary := lines[i+1]
+		i++
+		// Tests the rules hide don't show up in the report so they don't get series either.
+		if TestRules.Classify(name).Hidden {
+			continue
+		}
+
+		s := parseAggrSummaryLine(summary)
+		if !s.known {
+			slog.Debug("unknown aggregated test summary", "test", name, "summary", summary)
+			continue
+		}
+		if s.disruption != nil {
+			disruption = append(disruption, *s.disruption)
+		}
+		// The mean disruption line doesn't say how many times the test failed.
+		if s.failed > 0 {
+			failures[name] = s.failed
+		}
+	}
+	return failures, disruption
+}
@@ -0,0 +1,41 @@
+package payload_processing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dperique/release-analysis/rules"
+)
+
+func TestParseAggrSummary(t *testing.T) {
+	saved := TestRules
+	t.Cleanup(func() { TestRules = saved })
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("rules:\n  - match: 'flaky \\[sig-foo\\]'\n    hide: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if TestRules, err = rules.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	failures, disruption := parseAggrSummary(`<html>
+Failed: <b>[sig-network] pods should successfully create sandboxes by other</b>
+<p>Passed 1 times, failed 9 times, skipped 0 times: we require at least one pass to consider it a success</p>
+Failed: <b>flaky [sig-foo] test</b>
+<p>Passed 0 times, failed 10 times, skipped 0 times: we require at least one pass to consider it a success</p>
+Failed: <b>[sig-network-edge] Application behind service load balancer with PDB remains available using new connections</b>
+<p>Failed: Mean disruption of openshift-api-new-connections is 12.30 seconds is more than the failureThreshold</p>
+Failed: <b>[sig-cli] oc explain</b>
+<p>some summary line nobody has seen before</p>
+</html>
+`)
+	if want := map[string]int{"[sig-network] pods should successfully create sandboxes by other": 9}; !reflect.DeepEqual(failures, want) {
+		t.Errorf("expected %v (without the hidden test), got %v", want, failures)
+	}
+	if want := []Disruption{{Backend: "openshift-api-new-connections", Statistic: "mean", Seconds: 12.3}}; !reflect.DeepEqual(disruption, want) {
+		t.Errorf("expected %v, got %v", want, disruption)
+	}
+}
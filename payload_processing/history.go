@@ -0,0 +1,222 @@
+package payload_processing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dperique/release-analysis/ci_url"
+	"github.com/dperique/release-analysis/terminal"
+)
+
+// historyTestsPerRun is how many failed tests we show under each failed run.
+const historyTestsPerRun = 3
+
+// historyTrendWindow is how many runs each pass rate in the trend covers.
+const historyTrendWindow = 5
+
+var (
+	// allBuildsRegex finds the runs in prow's job history page, e.g.,
+	// var allBuilds = [{"SpyglassLink":"/view/gs/...","ID":"1782...","Started":"...","Duration":8100000000000,"Result":"FAILURE"}];
+	allBuildsRegex = regexp.MustCompile(`var allBuilds = (\[.*\]);`)
+
+	// olderRunsRegex finds the link to the next (older) page of prow's job history.
+	olderRunsRegex = regexp.MustCompile(`<a href="([^"]*\?buildId=\d+)"[^>]*>[^<]*Older Runs`)
+)
+
+// JobRun is a run of a job from prow's job history.
+type JobRun struct {
+	Url      string // the prow page of the run
+	ID       string
+	Started  time.Time
+	Duration time.Duration // how long it ran (so far, if it's still running)
+	Result   string        // SUCCESS, FAILURE, PENDING, ABORTED or ERROR
+}
+
+// GetJobHistory returns the last runs (newest first) of a job from prow's job history, going to
+// the older pages until it has enough.  If an older page can't be read, the runs so far are
+// returned.
+func GetJobHistory(bucket, jobName string, runs int) ([]JobRun, error) {
+	historyUrl := ci_url.JobHistoryUrl(bucket, jobName)
+	jobRuns := []JobRun{}
+	seen := map[string]bool{}
+	for pageUrl := historyUrl; pageUrl != "" && len(jobRuns) < runs; {
+		start := time.Now()
+		body, err := getBodyTimeout(pageUrl, BODY_TIMEOUT)
+		if err == nil && strings.Contains(string(body), NOT_SERVING) {
+			err = errNotServing
+		}
+		if err != nil {
+			logDownloadError("GetJobHistory", pageUrl, start, err)
+			if len(jobRuns) > 0 {
+				break
+			}
+			return nil, err
+		}
+
+		m := allBuildsRegex.FindSubmatch(body)
+		if m == nil {
+			return jobRuns, fmt.Errorf("%s: %w: no runs found", pageUrl, errParse)
+		}
+		var builds []struct {
+			SpyglassLink string
+			ID           string
+			Started      time.Time
+			Duration     time.Duration
+			Result       string
+		}
+		if err := json.Unmarshal(m[1], &builds); err != nil {
+			return jobRuns, fmt.Errorf("%s: %w: %v", pageUrl, errParse, err)
+		}
+		for _, b := range builds {
+			if seen[b.ID] || len(jobRuns) == runs {
+				continue
+			}
+			seen[b.ID] = true
+			jobRuns = append(jobRuns, JobRun{Url: ci_url.ProwPrefix + b.SpyglassLink, ID: b.ID, Started: b.Started, Duration: b.Duration, Result: b.Result})
+		}
+
+		pageUrl = ""
+		if older := olderRunsRegex.FindSubmatch(body); older != nil {
+			pageUrl = ci_url.ProwPrefix + string(older[1])
+		}
+	}
+	slog.Debug("got job history", "job", jobName, "runs", len(jobRuns))
+	return jobRuns, nil
+}
+
+// PrintJobHistory prints the runs of a job (newest first) to w with their build farm, result,
+// duration and top failed tests, then the pass rate, how it trends and the tests that failed the
+// most.
+func PrintJobHistory(w io.Writer, jobName string, jobRuns []JobRun) {
+	fmt.Fprintf(w, "%s: last %d runs (newest first)\n", jobName, len(jobRuns))
+
+	// Getting the build farm and junit of every run is slow so do them all at the same time.
+	lines := make([][]string, len(jobRuns))
+	failures := make([][]string, len(jobRuns))
+	results := make([]JobResult, len(jobRuns))
+	var wg sync.WaitGroup
+	for i, run := range jobRuns {
+		wg.Add(1)
+		go func(i int, run JobRun) {
+			defer wg.Done()
+			result := strings.ToLower(run.Result)
+			if len(result) < 4 {
+				result = "unknown"
+			}
+			jobLines := []string{getJobStr(run.Url, result, run.Duration.Round(time.Second).String()) + "\n"}
+			if run.Result == "FAILURE" {
+				// The same tests a plain job shows (without the ones the rules hide); just the names.
+				_, failures[i], results[i] = printPlainSummaryTests(io.Discard, run.Url, "", false, false, "")
+				jobLines = append(jobLines, results[i].line("      "))
+				for n, name := range failures[i] {
+					if n == historyTestsPerRun {
+						jobLines = append(jobLines, fmt.Sprintf("      ... and %d more\n", len(failures[i])-historyTestsPerRun))
+						break
+					}
+					line := fmt.Sprintf("      %sFailed: %s%s", red, testLink(run.Url, name, name), colorNone)
+					jobLines = append(jobLines, terminal.Wrap(line, "        ")+"\n")
+				}
+			}
+			lines[i] = jobLines
+		}(i, run)
+	}
+	wg.Wait()
+	for _, jobLines := range lines {
+		for _, line := range jobLines {
+			fmt.Fprint(w, line)
+		}
+	}
+	fmt.Fprint(w, statusSummary(results, "    "))
+	fmt.Fprintln(w)
+
+	printPassRateTrend(w, jobRuns)
+	PrintMostFailedTests(w, "runs", failures)
+}
+
+// printPassRateTrend prints the pass rate of the finished runs, a strip of the runs (oldest first)
+// and the pass rate of every historyTrendWindow of them so you can see if the job is getting
+// better or worse.
+func printPassRateTrend(w io.Writer, jobRuns []JobRun) {
+	passed, finished := 0, 0
+	strip := ""
+	window := []string{}
+	windowPassed, windowFinished := 0, 0
+	for i := len(jobRuns) - 1; i >= 0; i-- {
+		switch jobRuns[i].Result {
+		case "SUCCESS":
+			passed++
+			finished++
+			windowPassed++
+			windowFinished++
+			strip += green + "S" + colorNone
+		case "FAILURE":
+			finished++
+			windowFinished++
+			strip += red + "F" + colorNone
+		default:
+			// Still running, aborted or an infrastructure error says nothing about the job.
+			strip += "-"
+		}
+		if (len(jobRuns)-i)%historyTrendWindow == 0 || i == 0 {
+			if windowFinished > 0 {
+				window = append(window, fmt.Sprintf("%d%%", windowPassed*100/windowFinished))
+			} else {
+				window = append(window, "-")
+			}
+			windowPassed, windowFinished = 0, 0
+		}
+	}
+	if finished == 0 {
+		fmt.Fprintln(w, "    Pass rate: no finished runs")
+		return
+	}
+	fmt.Fprintf(w, "    Pass rate: %d%% (%d of %d finished runs)\n", passed*100/finished, passed, finished)
+	fmt.Fprintf(w, "    Trend (oldest first): %s\n", strip)
+	fmt.Fprintf(w, "    Pass rate every %d runs (oldest first): %s\n", historyTrendWindow, strings.Join(window, " "))
+}
+
+// PrintMostFailedTests prints the tests that failed in the most runs to w (failures has the
+// failed tests of each run); what says what the runs are (e.g., runs or urls).
+func PrintMostFailedTests(w io.Writer, what string, failures [][]string) {
+	counts := map[string]int{}
+	for _, names := range failures {
+		// A test that failed more than once in a run (e.g., in two jobs of a payload) counts once.
+		seen := map[string]bool{}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				counts[name]++
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+	names := []string{}
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "    Most failed tests (%s failed in):\n", what)
+	for i, name := range names {
+		if i == MAX_TESTS {
+			fmt.Fprintf(w, "      ... and %d more\n", len(names)-MAX_TESTS)
+			break
+		}
+		fmt.Fprintln(w, terminal.Wrap(fmt.Sprintf("      %3d %s", counts[name], name), "          "))
+	}
+}
@@ -0,0 +1,82 @@
+package payload_processing
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dperique/release-analysis/install_analysis"
+)
+
+// LOG_BUNDLE_TIMEOUT is longer than JUNIT_TIMEOUT since log bundles can be 100M.
+const LOG_BUNDLE_TIMEOUT = 120 * time.Second
+
+var (
+	// installLogRegex matches the base name of an installer log (e.g., .openshift_install-1713700000.log).
+	installLogRegex = regexp.MustCompile(`^\.openshift_install.*\.log$`)
+
+	// logBundleRegex matches the base name of a bootstrap gather log bundle.
+	logBundleRegex = regexp.MustCompile(`^log-bundle.*\.tar(\.gz)?$`)
+)
+
+// InstallSignatures are used to classify install failures; the commands replace them with the
+// --install-signatures file.
+var InstallSignatures = install_analysis.Default()
+
+// isInstallStep returns true for steps that install a cluster (e.g., ipi-install-install or
+// upi-install-gcp).
+func isInstallStep(step string) bool {
+	return strings.Contains(step, "install")
+}
+
+// analyzeInstall scans the installer logs and log bundles saved by an install step (stepUrl is
+// the gcsweb url of the step's directory) and returns what install signatures matched.
+func analyzeInstall(stepUrl string) []*install_analysis.Finding {
+	_, files, err := listGcsDir(stepUrl + "artifacts/")
+	if err != nil {
+		return nil
+	}
+
+	analysis := InstallSignatures.NewAnalysis()
+	for _, fileUrl := range files {
+		name := path.Base(fileUrl)
+		switch {
+		case installLogRegex.MatchString(name):
+			body, err := openUrlTimeout(fileUrl, JUNIT_TIMEOUT)
+			if err != nil {
+				continue
+			}
+			_ = analysis.ScanLog(name, body)
+			body.Close()
+		case logBundleRegex.MatchString(name):
+			body, err := openUrlTimeout(fileUrl, LOG_BUNDLE_TIMEOUT)
+			if err != nil {
+				continue
+			}
+			_ = analysis.ScanLogBundle(body)
+			body.Close()
+		}
+	}
+	return analysis.Findings()
+}
+
+// installOutputLines formats the install failure classification of a step.
+func installOutputLines(findings []*install_analysis.Finding, extraSpace string) []string {
+	if len(findings) == 0 {
+		return nil
+	}
+	output := []string{}
+	for i, f := range findings {
+		label := "Also matched"
+		if i == 0 {
+			label = "Install failure"
+		}
+		output = append(output, fmt.Sprintf("      %s%s%s: %s (%s), %d line(s)%s\n", extraSpace, orange, label, f.Signature.Name, f.Signature.Description, f.Count, colorNone))
+		for _, line := range f.Lines {
+			output = append(output, fmt.Sprintf("        %s%s: %s\n", extraSpace, line.Source, line.Text))
+		}
+	}
+	return output
+}
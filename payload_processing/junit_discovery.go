@@ -0,0 +1,256 @@
+package payload_processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dperique/release-analysis/ci_url"
+	"github.com/dperique/release-analysis/junit"
+)
+
+const (
+	gcsWebUrlPrefix = ci_url.GcsWebPrefix
+
+	// A junit file is at most at artifacts/<target>/<step>/artifacts/junit/<file> so we don't
+	// need to go deeper than this when walking the artifacts tree.
+	junitMaxDepth = 5
+
+	// How many gcsweb directory listings we fetch at the same time.
+	junitWalkConcurrency = 8
+
+	// How many junit files we download (and decode) at the same time.
+	junitFetchConcurrency = 4
+)
+
+var (
+	// gcsWebHrefRegex finds the links in a gcsweb directory listing.
+	gcsWebHrefRegex = regexp.MustCompile(`<a href="(/gcs/[^"]+)"`)
+
+	// junitFileRegex matches the base name of a junit file.
+	junitFileRegex = regexp.MustCompile(`^junit.*\.xml$`)
+
+	// These directories are big (thousands of files) and never have junit files in them so
+	// skip them when walking the artifacts tree.
+	junitSkipDirs = map[string]bool{
+		"gather-extra":       true,
+		"gather-must-gather": true,
+		"gather-audit-logs":  true,
+		"gather-core-dump":   true,
+		"gather-network":     true,
+		"must-gather":        true,
+		"nodes":              true,
+		"pods":               true,
+		"audit-logs":         true,
+		"build-resources":    true,
+		"release":            true,
+	}
+)
+
+// KeepArtifactsDir, if set, is where the raw junit files are saved (in a sub-directory per job id)
+// for people who want to inspect them; by default nothing is written to disk.
+var KeepArtifactsDir string
+
+// junitFile is a junit xml file we found in the artifacts of a job run.
+type junitFile struct {
+	step string // the step the file came from (e.g., openshift-e2e-test) or ci-operator for top level files
+	url  string
+}
+
+// gcsWebUrl takes a job url (see ci_url.Resolve) and returns the gcsweb url for its artifacts.  A
+// url that isn't a job run is returned as is so downloading from it fails (and says why).
+func gcsWebUrl(jobUrl string) string {
+	ref, err := ci_url.Resolve(jobUrl)
+	if err != nil {
+		slog.Debug("unable to resolve job url", "op", "gcsWebUrl", "err", err)
+		return jobUrl
+	}
+	return ref.GcsWebUrl()
+}
+
+// listGcsDir takes a gcsweb directory url and returns the urls of the sub-directories and
+// files in it.  Directory urls end with a "/".
+func listGcsDir(dirUrl string) ([]string, []string, error) {
+	body, err := getBodyTimeout(dirUrl, BODY_TIMEOUT)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.Contains(string(body), NOT_SERVING) {
+		return nil, nil, fmt.Errorf("%s: %w", dirUrl, errNotServing)
+	}
+
+	// The listing links are relative to the gcsweb host; the parent directory link is
+	// shorter than the current directory so we only keep links below us.
+	dirPath := strings.TrimPrefix(dirUrl, gcsWebUrlPrefix)
+	if !strings.HasSuffix(dirPath, "/") {
+		dirPath += "/"
+	}
+	dirs := []string{}
+	files := []string{}
+	for _, m := range gcsWebHrefRegex.FindAllStringSubmatch(string(body), -1) {
+		href := m[1]
+		if !strings.HasPrefix(href, dirPath) || len(href) <= len(dirPath) {
+			continue
+		}
+		if strings.HasSuffix(href, "/") {
+			dirs = append(dirs, gcsWebUrlPrefix+href)
+		} else {
+			files = append(files, gcsWebUrlPrefix+href)
+		}
+	}
+	return dirs, files, nil
+}
+
+// junitStepName returns the step name for a file given its path relative to the artifacts directory
+// (i.e., <target>/<step>/...).  Files at the top of artifacts come from ci-operator itself.
+func junitStepName(relPath string) string {
+	parts := strings.Split(relPath, "/")
+	switch {
+	case len(parts) <= 1:
+		return "ci-operator"
+	case len(parts) == 2:
+		return parts[0]
+	default:
+		return parts[1]
+	}
+}
+
+// discoverJunitFiles walks the artifacts tree of a job run (artifactsUrl is the gcsweb url of
+// the artifacts directory) and returns every junit*.xml file it finds labeled by its step.
+// This way, we don't need to know where each kind of job puts its junit files.  The error is
+// for the artifacts directory itself (sub-directories we can't list are skipped).
+func discoverJunitFiles(artifactsUrl string) ([]junitFile, error) {
+	if !strings.HasSuffix(artifactsUrl, "/") {
+		artifactsUrl += "/"
+	}
+
+	var (
+		mu      sync.Mutex
+		found   []junitFile
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, junitWalkConcurrency)
+		rootErr error
+	)
+
+	var walk func(dirUrl string, depth int)
+	walk = func(dirUrl string, depth int) {
+		defer wg.Done()
+		sem <- struct{}{}
+		dirs, files, err := listGcsDir(dirUrl)
+		<-sem
+		if err != nil {
+			if depth == 1 {
+				rootErr = err
+			}
+			return
+		}
+		for _, fileUrl := range files {
+			if !junitFileRegex.MatchString(path.Base(fileUrl)) {
+				continue
+			}
+			mu.Lock()
+			found = append(found, junitFile{
+				step: junitStepName(strings.TrimPrefix(fileUrl, artifactsUrl)),
+				url:  fileUrl,
+			})
+			mu.Unlock()
+		}
+		if depth >= junitMaxDepth {
+			return
+		}
+		for _, subDirUrl := range dirs {
+			if junitSkipDirs[path.Base(subDirUrl)] {
+				continue
+			}
+			wg.Add(1)
+			go walk(subDirUrl, depth+1)
+		}
+	}
+	wg.Add(1)
+	walk(artifactsUrl, 1)
+	wg.Wait()
+
+	// Keep the order stable since the walk is done concurrently.
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].url < found[j].url
+	})
+	return found, rootErr
+}
+
+// junitDocument is a decoded junit file (or the reason it couldn't be decoded).
+type junitDocument struct {
+	file   junitFile
+	suites *junit.Suites
+	err    error
+}
+
+// fetchJunitDocument streams one junit file into the junit decoder; if KeepArtifactsDir is
+// set, the raw file is also saved there under jobId.
+func fetchJunitDocument(jobId string, file junitFile) junitDocument {
+	// Note the timeout of 50 seconds; this is because those junit.xml file are
+	// sometimes in the 10M and 20M range.  GCS is probably throttling the speed
+	// at which we can download.
+	body, err := openUrlTimeout(file.url, JUNIT_TIMEOUT)
+	if err != nil {
+		return junitDocument{file: file, err: err}
+	}
+	defer body.Close()
+
+	var reader io.Reader = body
+	if KeepArtifactsDir != "" {
+		dirPath := filepath.Join(KeepArtifactsDir, jobId)
+		if err := os.MkdirAll(dirPath, 0755); err != nil {
+			return junitDocument{file: file, err: err}
+		}
+		// Files from different steps can have the same name so include the step.
+		outputFile, err := os.Create(filepath.Join(dirPath, file.step+"-"+path.Base(file.url)))
+		if err != nil {
+			return junitDocument{file: file, err: err}
+		}
+		defer outputFile.Close()
+		reader = io.TeeReader(body, outputFile)
+	}
+
+	suites, err := junit.Parse(reader)
+	var netErr net.Error
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.As(err, &netErr) {
+		// The file is there but it's not junit we understand (as opposed to the download failing).
+		err = fmt.Errorf("%w: %v", errParse, err)
+	}
+	if KeepArtifactsDir != "" {
+		// The decoder stops at the end of the root element; save the rest of the file too.
+		_, _ = io.Copy(io.Discard, reader)
+	}
+	return junitDocument{file: file, suites: suites, err: err}
+}
+
+// fetchJunitDocuments downloads and decodes the junit files of a job run in parallel and returns
+// them in the same order as junitFiles.
+func fetchJunitDocuments(jobUrl string, junitFiles []junitFile) []junitDocument {
+	jobId := path.Base(strings.TrimSuffix(jobUrl, "/"))
+
+	docs := make([]junitDocument, len(junitFiles))
+	sem := make(chan struct{}, junitFetchConcurrency)
+	var wg sync.WaitGroup
+	for i, file := range junitFiles {
+		wg.Add(1)
+		go func(i int, file junitFile) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			docs[i] = fetchJunitDocument(jobId, file)
+		}(i, file)
+	}
+	wg.Wait()
+	return docs
+}
@@ -5,13 +5,12 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-
-	goutils "github.com/dperique/goutils"
+	"time"
 )
 
 type PayloadGetter interface {
 	// Given a release version and stream, return a list of payload items.
-	getUrls(aVersion, aStream string) []ReleasePayload
+	getUrls(aVersion, aStream string) ([]ReleasePayload, error)
 }
 
 // These are the three ways we can get the payload items.
@@ -24,15 +23,14 @@ type RcAPIPayloadGetter struct{}
 // aVersion is like 4.12, 4.13, 4.14
 // aStream is like nightly or ci
 // TODO: this is a little wacky in that we "chop" parts to get to the part we want. Convert to getUrlsFromSippy.
-func (g RcWebpagePayloadGetter) getUrls(aVersion, aStream string) []ReleasePayload {
+func (g RcWebpagePayloadGetter) getUrls(aVersion, aStream string) ([]ReleasePayload, error) {
 	releaseStr := fmt.Sprintf("%s/#%s.0-0.%s", releaseUrlPrefix, aVersion, aStream)
+	start := time.Now()
 	body, err := getBodyTimeout(releaseStr, BODY_TIMEOUT)
 	var ret []ReleasePayload
 	if err != nil {
-		if err == errDownloadTookTooLong {
-			fmt.Println("Download problem 3")
-			goutils.CheckErrFatal(err)
-		}
+		logDownloadError("RcWebpagePayloadGetter", releaseStr, start, err)
+		return nil, err
 	}
 	var currfStr string
 	switch aStream {
@@ -41,9 +39,12 @@ func (g RcWebpagePayloadGetter) getUrls(aVersion, aStream string) []ReleasePaylo
 	case "ci":
 		currfStr = fmt.Sprintf("This release contains CI image builds of all code in release-%s (master) branches, and is updated each time someone merges.", aVersion)
 	default:
-		goutils.CheckErrFatal(fmt.Errorf("bad value for aType: %s", aStream))
+		return nil, fmt.Errorf("bad value for aType: %s", aStream)
 	}
 	t := strings.Split(string(body), currfStr)
+	if len(t) < 2 {
+		return nil, fmt.Errorf("%s: no %s %s payloads found", releaseStr, aVersion, aStream)
+	}
 	x := t[1]
 	var prevVer string
 
@@ -63,7 +64,7 @@ func (g RcWebpagePayloadGetter) getUrls(aVersion, aStream string) []ReleasePaylo
 	case "4.12":
 		prevVer = "4.11"
 	default:
-		goutils.CheckErrFatal(fmt.Errorf("bad value for aVersion: %s", aVersion))
+		return nil, fmt.Errorf("bad value for aVersion: %s", aVersion)
 	}
 
 	var prevfStr string
@@ -76,7 +77,7 @@ func (g RcWebpagePayloadGetter) getUrls(aVersion, aStream string) []ReleasePaylo
 		prevfStr = fmt.Sprintf("This release contains OSBS official image builds of all code in release-%s (master) branches, and is updated after those builds are synced to quay.io.", prevVer)
 		endChar = 79
 	default:
-		goutils.CheckErrFatal(fmt.Errorf("bad value for aType: %s", aStream))
+		return nil, fmt.Errorf("bad value for aType: %s", aStream)
 	}
 
 	u := strings.Split(x, prevfStr)
@@ -124,7 +125,7 @@ func (g RcWebpagePayloadGetter) getUrls(aVersion, aStream string) []ReleasePaylo
 			i = i + 2
 		}
 	}
-	return ret
+	return ret, nil
 }
 
 // getUrls fetches the urls from the sippy database.
@@ -132,15 +133,14 @@ func (g RcWebpagePayloadGetter) getUrls(aVersion, aStream string) []ReleasePaylo
 // This is a cleaner way to do this but we miss out on the timeStr and timeDetailStr so we
 // give the user the option.
 // aStream is one of ci or nightly.
-func (g SippyDBPayloadGetter) getUrls(aVersion, aStream string) []ReleasePayload {
+func (g SippyDBPayloadGetter) getUrls(aVersion, aStream string) ([]ReleasePayload, error) {
 	sippyUrl := "https://sippy.dptools.openshift.org/api/releases/tags?&release=%s"
+	start := time.Now()
 	body, err := getBodyTimeout(fmt.Sprintf(sippyUrl, aVersion), BODY_TIMEOUT)
 	var ret []ReleasePayload
 	if err != nil {
-		if err == errDownloadTookTooLong {
-			fmt.Println("Download problem on sippy API for releases")
-			goutils.CheckErrFatal(err)
-		}
+		logDownloadError("SippyDBPayloadGetter", fmt.Sprintf(sippyUrl, aVersion), start, err)
+		return nil, err
 	}
 	type releaseItem struct {
 		Release_tag    string
@@ -154,10 +154,8 @@ func (g SippyDBPayloadGetter) getUrls(aVersion, aStream string) []ReleasePayload
 	releaseList := []releaseItem{}
 	err = json.Unmarshal(body, &releaseList)
 	if err != nil {
-		if err == errDownloadTookTooLong {
-			fmt.Println("Problem unmarshalling sippy releases data into a releaseItem struct")
-			goutils.CheckErrFatal(err)
-		}
+		// An empty list would look like a release with no payloads (e.g., nothing rejected).
+		return nil, fmt.Errorf("unable to parse sippy releases from %s: %w: %v", fmt.Sprintf(sippyUrl, aVersion), errParse, err)
 	}
 
 	for _, relItem := range releaseList {
@@ -181,23 +179,20 @@ func (g SippyDBPayloadGetter) getUrls(aVersion, aStream string) []ReleasePayload
 			timeStr:    relItem.Release_time,
 		})
 	}
-	return ret
+	return ret, nil
 }
 
 // getUrls fetches the urls from the release-controller api.  This is a cleaner way to
 // do this but we miss out on the timeStr and timeDetailStr so we give the user the option.
-func (g RcAPIPayloadGetter) getUrls(aVersion, aStream string) []ReleasePayload {
+func (g RcAPIPayloadGetter) getUrls(aVersion, aStream string) ([]ReleasePayload, error) {
 	const relContStr = "https://amd64.ocp.releases.ci.openshift.org/api/v1/releasestream/%s.0-0.%s/tags"
 	releaseStr := fmt.Sprintf(relContStr, aVersion, aStream)
-	fmt.Println(releaseStr)
+	start := time.Now()
 	body, err := getBodyTimeout(releaseStr, BODY_TIMEOUT)
 	var ret []ReleasePayload
 	if err != nil {
-		if err == errDownloadTookTooLong {
-			fmt.Println("Error talking to release-controller api")
-			goutils.CheckErrFatal(err)
-		}
-		goutils.CheckErrFatal(err)
+		logDownloadError("RcAPIPayloadGetter", releaseStr, start, err)
+		return nil, err
 	}
 
 	type tag struct {
@@ -213,10 +208,7 @@ func (g RcAPIPayloadGetter) getUrls(aVersion, aStream string) []ReleasePayload {
 	releaseList := rcReleaseItems{}
 	err = json.Unmarshal(body, &releaseList)
 	if err != nil {
-		if err == errDownloadTookTooLong {
-			fmt.Println("Error unmarshalling release-controller output")
-			goutils.CheckErrFatal(err)
-		}
+		return nil, fmt.Errorf("unable to parse release-controller tags from %s: %w: %v", releaseStr, errParse, err)
 	}
 	for _, relItem := range releaseList.Tags {
 		ret = append(ret, ReleasePayload{
@@ -225,9 +217,24 @@ func (g RcAPIPayloadGetter) getUrls(aVersion, aStream string) []ReleasePayload {
 			timeStr:    "Unknown ago", // TODO: you can maybe calculate from the Name vs. time.Now()
 		})
 	}
-	return ret
+	return ret, nil
 }
 
-func GetPayloadItems(releaseVersion, releaseStream string, p PayloadGetter) []ReleasePayload {
+// GetPayloadItems returns the payloads of a release version and stream.
+func GetPayloadItems(releaseVersion, releaseStream string, p PayloadGetter) ([]ReleasePayload, error) {
 	return p.getUrls(releaseVersion, releaseStream)
 }
+
+// NewPayloadGetter returns the PayloadGetter for a dbMode (rcWebpage, sippyDB or rcAPI); it
+// returns the rcWebpage one (and false) for anything else.
+func NewPayloadGetter(dbMode string) (PayloadGetter, bool) {
+	switch dbMode {
+	case "rcWebpage":
+		return RcWebpagePayloadGetter{}, true
+	case "sippyDB":
+		return SippyDBPayloadGetter{}, true
+	case "rcAPI":
+		return RcAPIPayloadGetter{}, true
+	}
+	return RcWebpagePayloadGetter{}, false
+}
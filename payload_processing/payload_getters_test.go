@@ -0,0 +1,19 @@
+package payload_processing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPayloadGettersBadJSON(t *testing.T) {
+	useCanned(t, map[string]string{
+		"https://sippy.dptools.openshift.org/api/releases/tags?&release=4.16":                    "<html>sippy is down</html>",
+		"https://amd64.ocp.releases.ci.openshift.org/api/v1/releasestream/4.16.0-0.nightly/tags": `{"name": "4.16.0-0.nightly", "tags": [`,
+	})
+	// A release we can't read isn't a release with no payloads.
+	for _, getter := range []PayloadGetter{SippyDBPayloadGetter{}, RcAPIPayloadGetter{}} {
+		if payloads, err := GetPayloadItems("4.16", "nightly", getter); err == nil || !strings.Contains(err.Error(), "unable to parse") {
+			t.Errorf("%T: expected a parse error, got %d payloads and %v", getter, len(payloads), err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package payload_processing
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// payloadRunJobRegex finds the prow links of the jobs on a /payload run page.
+var payloadRunJobRegex = regexp.MustCompile(`href="(https://prow\.ci\.openshift\.org/view/[^"]+)"`)
+
+// GetPayloadRunJobs takes the page of a /payload run (e.g.,
+// https://pr-payload-tests.ci.openshift.org/runs/ci/<run id>) and returns the prow urls of its jobs.
+func GetPayloadRunJobs(runUrl string) ([]string, error) {
+	start := time.Now()
+	body, err := getBodyTimeout(runUrl, BODY_TIMEOUT)
+	if err != nil {
+		logDownloadError("GetPayloadRunJobs", runUrl, start, err)
+		return nil, err
+	}
+
+	jobUrls := []string{}
+	seen := map[string]bool{}
+	for _, m := range payloadRunJobRegex.FindAllStringSubmatch(string(body), -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			jobUrls = append(jobUrls, m[1])
+		}
+	}
+	if len(jobUrls) == 0 {
+		return nil, fmt.Errorf("%s: no jobs found", runUrl)
+	}
+	return jobUrls, nil
+}
@@ -0,0 +1,32 @@
+package payload_processing
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/dperique/release-analysis/ci_url"
+	"github.com/dperique/release-analysis/terminal"
+)
+
+// sippyTestUrl is sippy's analysis of a test for a version (e.g., 4.16).
+const sippyTestUrl = "https://sippy.dptools.openshift.org/sippy-ng/tests/%s/analysis?test=%s"
+
+// jobUrlStr returns how to show the url of a job run: the url or, if hyperlinks are on, the job
+// name and id as a link to it.
+func jobUrlStr(jobUrl string) string {
+	ref, err := ci_url.Resolve(jobUrl)
+	if !terminal.Hyperlinks || err != nil {
+		return jobUrl
+	}
+	return terminal.Link(jobUrl, ref.JobName+"/"+ref.BuildID)
+}
+
+// testLink returns text (the test name, maybe shortened) as a link to the sippy analysis of the
+// test for the version of the job run it failed in.
+func testLink(jobUrl, testName, text string) string {
+	ref, err := ci_url.Resolve(jobUrl)
+	if err != nil || ref.Version == "" {
+		return text
+	}
+	return terminal.Link(fmt.Sprintf(sippyTestUrl, ref.Version, url.QueryEscape(testName)), text)
+}
@@ -0,0 +1,169 @@
+package payload_processing
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxSignatureLen is how much of the normalized failure message we use as its signature.
+const maxSignatureLen = 200
+
+// failureNormalizers strip the parts of a failure message that change from run to run (in this
+// order) so that messages with the same root cause end up with the same signature.
+var failureNormalizers = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{regexp.MustCompile(`\b[IWEF]\d{4} \d{2}:\d{2}:\d{2}\.\d+`), "<time>"},
+	{regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(\.\d+)?\b`), "<time>"},
+	{regexp.MustCompile(`\bip-\d{1,3}-\d{1,3}-\d{1,3}-\d{1,3}\b`), "ip-<ip>"},
+	{regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\[?\b[0-9a-f]{1,4}(:[0-9a-f]{0,4}){3,7}\]?(:\d+)?`), "<ip>"},
+	{regexp.MustCompile(`\bpods?/[a-z0-9][a-z0-9.-]*`), "pod/<pod>"},
+	{regexp.MustCompile(`\bns/e2e-[a-z0-9-]+`), "ns/<e2e-ns>"},
+	{regexp.MustCompile(`\be2e-test-[a-z0-9-]+`), "<e2e-ns>"},
+	// Generated pod name suffixes (e.g., -7d4b9c8f5b-x2x9z or -x2x9z).
+	{regexp.MustCompile(`-[a-f0-9]{8,10}-[bcdfghjklmnpqrstvwxz2456789]{5}\b`), "-<pod>"},
+	{regexp.MustCompile(`-[bcdfghjklmnpqrstvwxz2456789]{5}\b`), "-<pod>"},
+	{regexp.MustCompile(`\b0x[0-9a-f]+\b`), "<addr>"},
+	{regexp.MustCompile(`\b(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+\b`), "<duration>"},
+	{regexp.MustCompile(`\b\d+(\.\d+)?\b`), "<n>"},
+	{regexp.MustCompile(`[ \t]+`), " "},
+}
+
+// normalizeFailure strips timestamps, pod names, IPs, UUIDs (and numbers in general) from a
+// failure message.
+func normalizeFailure(text string) string {
+	for _, n := range failureNormalizers {
+		text = n.re.ReplaceAllString(text, n.replacement)
+	}
+	return strings.TrimSpace(text)
+}
+
+// failureSignature returns the signature of a failure message; it's the first non-empty line of
+// the normalized message since that is where openshift-tests puts the file:line and error.
+func failureSignature(text string) string {
+	for _, line := range strings.Split(normalizeFailure(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(line) > maxSignatureLen {
+			line = line[:maxSignatureLen]
+		}
+		return line
+	}
+	return ""
+}
+
+// signatureEntry holds everything that failed with the same signature.
+type signatureEntry struct {
+	signature string
+	count     int
+	tests     map[string]bool
+	jobs      map[string]bool
+	payloads  map[string]bool
+}
+
+// failureSignatureCollector gathers failure signatures across jobs and payloads; jobs are
+// processed in go routines so it is protected by a mutex.
+type failureSignatureCollector struct {
+	mu      sync.Mutex
+	entries map[string]*signatureEntry
+}
+
+// failureSignatures collects the signatures for the whole run (e.g., all payloads of a
+// "payload" command) and is printed by PrintFailureSignatures.
+var failureSignatures = &failureSignatureCollector{entries: map[string]*signatureEntry{}}
+
+// add records a failure of testName in jobUrl (which is part of payloadName, if known).
+func (c *failureSignatureCollector) add(failureText, testName, jobUrl, payloadName string) {
+	signature := failureSignature(failureText)
+	if signature == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[signature]
+	if !ok {
+		e = &signatureEntry{
+			signature: signature,
+			tests:     map[string]bool{},
+			jobs:      map[string]bool{},
+			payloads:  map[string]bool{},
+		}
+		c.entries[signature] = e
+	}
+	e.count++
+	e.tests[testName] = true
+	e.jobs[jobUrl] = true
+	if payloadName != "" {
+		e.payloads[payloadName] = true
+	}
+}
+
+// sortedKeys returns the keys of a set sorted.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PrintFailureSignatures prints the failure signatures collected so far to w (the ones shared by
+// the most tests first) so we can tell if many failing tests have the same root cause; the
+// collected signatures are then cleared.
+func PrintFailureSignatures(w io.Writer) {
+	failureSignatures.mu.Lock()
+	entries := make([]*signatureEntry, 0, len(failureSignatures.entries))
+	for _, e := range failureSignatures.entries {
+		entries = append(entries, e)
+	}
+	failureSignatures.entries = map[string]*signatureEntry{}
+	failureSignatures.mu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if len(entries[i].tests) != len(entries[j].tests) {
+			return len(entries[i].tests) > len(entries[j].tests)
+		}
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].signature < entries[j].signature
+	})
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Failure signatures (%d):\n", len(entries))
+	for _, e := range entries {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "  %s[%d tests, %d jobs, %d payloads]%s %s\n", red, len(e.tests), len(e.jobs), len(e.payloads), colorNone, e.signature)
+		for _, section := range []struct {
+			label string
+			items []string
+		}{
+			{"test:   ", sortedKeys(e.tests)},
+			{"job:    ", sortedKeys(e.jobs)},
+			{"payload:", sortedKeys(e.payloads)},
+		} {
+			for i, item := range section.items {
+				if i == MAX_TESTS {
+					fmt.Fprintf(w, "      %s ... and %d more\n", section.label, len(section.items)-MAX_TESTS)
+					break
+				}
+				fmt.Fprintf(w, "      %s %s\n", section.label, item)
+			}
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,171 @@
+package payload_processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/dperique/release-analysis/fetch"
+)
+
+// JobStatus says whether we could analyze a job run and, if not, why.  Anything other than
+// JobOK means what we show for the job is incomplete.
+type JobStatus int
+
+const (
+	JobOK                JobStatus = iota
+	JobNotYetUploaded              // the job is still running or its artifacts haven't been uploaded yet
+	JobArtifactMissing             // the job finished but an artifact we need is gone (404 or NOT_SERVING)
+	JobTimedOut                    // an artifact took too long to download
+	JobParseError                  // an artifact is there but we couldn't make sense of it
+	JobUnsupportedLayout           // the artifacts aren't where (or what) we expect for this kind of job
+)
+
+var jobStatusNames = map[JobStatus]string{
+	JobOK:                "ok",
+	JobNotYetUploaded:    "not-yet-uploaded",
+	JobArtifactMissing:   "artifact-missing",
+	JobTimedOut:          "timed-out",
+	JobParseError:        "parse-error",
+	JobUnsupportedLayout: "unsupported-layout",
+}
+
+func (s JobStatus) String() string {
+	if name, ok := jobStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("JobStatus(%d)", int(s))
+}
+
+var (
+	// errNotServing is returned when gcsweb shows its NOT_SERVING page instead of the artifact
+	// (fetch returns it for the 503 page; a 200 with the page is checked for by the callers).
+	errNotServing = fetch.ErrNotServing
+
+	// errParse wraps errors decoding an artifact.
+	errParse = errors.New("parse error")
+)
+
+// JobResult is the status of a job run along with the artifact that caused it (if not JobOK).
+type JobResult struct {
+	Url      string // the job run
+	Status   JobStatus
+	Artifact string // the artifact we couldn't get (or use)
+	Reason   string // why, e.g., "404 Not Found" or "no junit files found"
+}
+
+// statusOf maps the error we got downloading (or decoding) an artifact to a JobStatus.
+func statusOf(err error) JobStatus {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return JobOK
+	case errors.Is(err, errDownloadTookTooLong), errors.Is(err, context.DeadlineExceeded):
+		return JobTimedOut
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return JobTimedOut
+	case errors.Is(err, errParse):
+		return JobParseError
+	default:
+		// A 404, NOT_SERVING or a server we can't reach: as far as we're concerned, the
+		// artifact is missing.
+		return JobArtifactMissing
+	}
+}
+
+// reasonOf returns a short description of err (the artifact url is shown separately).
+func reasonOf(err error) string {
+	var statusErr *fetch.StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.Status
+	case errors.Is(err, errNotServing):
+		return "not serving"
+	case errors.Is(err, errDownloadTookTooLong):
+		return errDownloadTookTooLong.Error()
+	}
+	return err.Error()
+}
+
+// jobFinished returns true if the job run (jobGcsUrl is its gcsweb directory) has finished and
+// uploaded its artifacts; finished.json is the last thing prow uploads.
+func jobFinished(jobGcsUrl string) bool {
+	body, err := getBodyTimeout(strings.TrimSuffix(jobGcsUrl, "/")+"/finished.json", BODY_TIMEOUT)
+	return err == nil && !strings.Contains(string(body), NOT_SERVING)
+}
+
+// artifactResult returns the JobResult for a job run (jobUrl) given the error we got for one of
+// its artifacts.  A missing artifact of a job that hasn't finished is not yet uploaded.
+func artifactResult(jobUrl, jobGcsUrl, artifact string, err error) JobResult {
+	if err == nil {
+		return JobResult{Url: jobUrl, Status: JobOK}
+	}
+	status := statusOf(err)
+	if status == JobArtifactMissing && !jobFinished(jobGcsUrl) {
+		status = JobNotYetUploaded
+	}
+	return JobResult{Url: jobUrl, Status: status, Artifact: artifact, Reason: reasonOf(err)}
+}
+
+// line renders a JobResult the same way everywhere (nothing for JobOK), e.g.:
+//
+//	[artifact-missing] https://.../aggregation-testrun-summary.html: 404 Not Found
+func (r JobResult) line(indent string) string {
+	if r.Status == JobOK {
+		return ""
+	}
+	color := red
+	if r.Status == JobNotYetUploaded {
+		color = cyan
+	}
+	detail := r.Reason
+	if r.Artifact != "" {
+		detail = r.Artifact + ": " + r.Reason
+	}
+	return fmt.Sprintf("%s%s[%s]%s %s\n", indent, color, r.Status, colorNone, detail)
+}
+
+// PrintListError prints why the payloads of a release (listUrl is its release-controller page)
+// couldn't be listed, e.g.:
+//
+//	[parse-error] unable to parse release-controller tags from https://...: parse error: ...
+func PrintListError(w io.Writer, listUrl string, err error) {
+	result := JobResult{Url: listUrl, Status: statusOf(err), Reason: reasonOf(err)}
+	var statusErr *fetch.StatusError
+	if errors.As(err, &statusErr) {
+		result.Artifact = statusErr.URL
+	}
+	fmt.Fprint(w, result.line("   "))
+}
+
+// merge returns which of r and other to report for a job: the first problem found.
+func (r JobResult) merge(other JobResult) JobResult {
+	if r.Status != JobOK {
+		return r
+	}
+	return other
+}
+
+// statusSummary returns a line like "Incomplete results: 2 artifact-missing, 1 timed-out" for
+// the job runs that couldn't be fully analyzed (nothing if they all could).
+func statusSummary(results []JobResult, indent string) string {
+	counts := map[JobStatus]int{}
+	for _, r := range results {
+		if r.Status != JobOK {
+			counts[r.Status]++
+		}
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for s := JobNotYetUploaded; s <= JobUnsupportedLayout; s++ {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	return fmt.Sprintf("%s%sIncomplete results:%s %s\n", indent, red, colorNone, strings.Join(parts, ", "))
+}
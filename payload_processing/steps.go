@@ -0,0 +1,180 @@
+package payload_processing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dperique/release-analysis/install_analysis"
+)
+
+// stepLogTailLines is how many lines from the end of a failed step's build log we show.
+const stepLogTailLines = 15
+
+// stepTestRegex matches the ci-operator junit test case for a multi-stage step, e.g.,
+// "Run multi-stage test e2e-aws-ovn-upgrade - e2e-aws-ovn-upgrade-ipi-install-install container test"
+var stepTestRegex = regexp.MustCompile(`^Run multi-stage test (\S+) - (\S+) container test$`)
+
+// stepResult is what we know about a multi-stage step that failed.
+type stepResult struct {
+	target   string // the ci-operator target (e.g., e2e-aws-ovn-upgrade)
+	step     string // the step (e.g., ipi-install-install)
+	result   string // from finished.json (e.g., FAILURE)
+	duration time.Duration
+	logTail  []string
+	stepUrl  string // gcsweb url of the step's artifacts directory
+
+	// install is the install failure classification for install steps.
+	install []*install_analysis.Finding
+}
+
+// stepTimestamp is the part of started.json and finished.json we care about.
+type stepTimestamp struct {
+	Timestamp int64  `json:"timestamp"`
+	Passed    *bool  `json:"passed"`
+	Result    string `json:"result"`
+}
+
+// getStepTimestamp gets and decodes a started.json or finished.json file.
+func getStepTimestamp(url string) (stepTimestamp, bool) {
+	var ts stepTimestamp
+	body, err := openUrlTimeout(url, BODY_TIMEOUT)
+	if err != nil {
+		return ts, false
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(&ts); err != nil {
+		return ts, false
+	}
+	return ts, true
+}
+
+// getLogTail returns the last n non-empty lines of a log file; the log is read line by line so
+// only the tail is kept in memory.
+func getLogTail(url string, n int) []string {
+	body, err := openUrlTimeout(url, JUNIT_TIMEOUT)
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, NOT_SERVING) {
+			return nil
+		}
+	}
+	return lines
+}
+
+// fillStepResult adds the result, duration (if not known yet) and build log tail of a step.
+func fillStepResult(s *stepResult) {
+	if finished, ok := getStepTimestamp(s.stepUrl + "finished.json"); ok {
+		s.result = finished.Result
+		if s.duration == 0 {
+			if started, ok := getStepTimestamp(s.stepUrl + "started.json"); ok && started.Timestamp > 0 {
+				s.duration = time.Duration(finished.Timestamp-started.Timestamp) * time.Second
+			}
+		}
+	}
+	if s.result == "" {
+		s.result = "FAILURE"
+	}
+	s.logTail = getLogTail(s.stepUrl+"build-log.txt", stepLogTailLines)
+	if isInstallStep(s.step) {
+		s.install = analyzeInstall(s.stepUrl)
+	}
+}
+
+// failedSteps returns the multi-stage steps that failed in a job run.  They come from ci-operator's
+// junit_operator.xml (in docs) and, if that is missing, from the finished.json of every step.
+func failedSteps(jobUrl string, docs []junitDocument) []stepResult {
+	artifactsUrl := gcsWebUrl(jobUrl) + "/artifacts/"
+
+	steps := []stepResult{}
+	for _, doc := range docs {
+		if doc.err != nil || path.Base(doc.file.url) != "junit_operator.xml" {
+			continue
+		}
+		for _, testcase := range doc.suites.TestCases() {
+			m := stepTestRegex.FindStringSubmatch(testcase.Name)
+			if len(m) < 3 || !testcase.Failed() {
+				continue
+			}
+			target := m[1]
+			step := strings.TrimPrefix(m[2], target+"-")
+			steps = append(steps, stepResult{
+				target:   target,
+				step:     step,
+				duration: time.Duration(testcase.Time * float64(time.Second)),
+				stepUrl:  fmt.Sprintf("%s%s/%s/", artifactsUrl, target, step),
+			})
+		}
+	}
+
+	if len(steps) == 0 {
+		// No junit_operator.xml (or it didn't say); look at each step's finished.json.
+		targetDirs, _, err := listGcsDir(artifactsUrl)
+		if err == nil {
+			for _, targetDir := range targetDirs {
+				stepDirs, _, err := listGcsDir(targetDir)
+				if err != nil {
+					continue
+				}
+				for _, stepDir := range stepDirs {
+					finished, ok := getStepTimestamp(stepDir + "finished.json")
+					if !ok || finished.Passed == nil || *finished.Passed {
+						continue
+					}
+					steps = append(steps, stepResult{
+						target:  path.Base(targetDir),
+						step:    path.Base(stepDir),
+						stepUrl: stepDir,
+					})
+				}
+			}
+		}
+	}
+
+	for i := range steps {
+		fillStepResult(&steps[i])
+	}
+	return steps
+}
+
+// stepOutputLines formats the failed steps of a job run.
+func stepOutputLines(steps []stepResult, extraSpace string) []string {
+	if len(steps) == 0 {
+		return nil
+	}
+	output := []string{fmt.Sprintf("    %sNo test failures found in junit; failed steps:\n", extraSpace)}
+	for _, s := range steps {
+		durationStr := "unknown time"
+		if s.duration > 0 {
+			durationStr = s.duration.Round(time.Second).String()
+		}
+		output = append(output, fmt.Sprintf("    %s%sStep %s (%s) %s after %s%s\n", extraSpace, red, s.step, s.target, s.result, durationStr, colorNone))
+		output = append(output, fmt.Sprintf("      %s%s\n", extraSpace, s.stepUrl+"build-log.txt"))
+		for _, line := range s.logTail {
+			output = append(output, fmt.Sprintf("        %s%s\n", extraSpace, line))
+		}
+		output = append(output, installOutputLines(s.install, extraSpace)...)
+	}
+	return output
+}
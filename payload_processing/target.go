@@ -0,0 +1,60 @@
+package payload_processing
+
+import (
+	"log/slog"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/dperique/release-analysis/ci_url"
+)
+
+var (
+	// ciOperatorTargetRegex finds the test ci-operator ran in a prowjob.json.
+	ciOperatorTargetRegex = regexp.MustCompile(`"--target=([^"]+)"`)
+
+	// These directories are in the artifacts of every ci-operator job; the other one is named
+	// after the test (the ci-operator target).
+	ciOperatorDirs = map[string]bool{
+		"build-logs":      true,
+		"build-resources": true,
+		"release":         true,
+		"junit":           true,
+	}
+)
+
+// JobTarget returns the name of the test a job run ran (its ci-operator target, e.g.,
+// e2e-aws-ovn-upgrade).  It comes from the job name if the name says (see ci_url.JobRef.Variant),
+// otherwise from the job's prowjob.json or the directories in its artifacts.  It's empty if none
+// of them say.
+func JobTarget(jobUrl string) string {
+	ref, err := ci_url.Resolve(jobUrl)
+	if err != nil {
+		slog.Debug("unable to resolve job url", "op", "JobTarget", "err", err)
+		return ""
+	}
+	if ref.Variant != "" {
+		return ref.Variant
+	}
+
+	prowJobJsonUrl := ref.GcsWebUrl() + "/prowjob.json"
+	start := time.Now()
+	body, err := getBodyTimeout(prowJobJsonUrl, BODY_TIMEOUT)
+	if err != nil {
+		logDownloadError("JobTarget", prowJobJsonUrl, start, err)
+	} else if m := ciOperatorTargetRegex.FindSubmatch(body); m != nil {
+		return string(m[1])
+	}
+
+	dirs, _, err := listGcsDir(ref.GcsWebUrl() + "/artifacts/")
+	if err != nil {
+		slog.Debug("unable to list the artifacts", "op", "JobTarget", "url", jobUrl, "err", err)
+		return ""
+	}
+	for _, dir := range dirs {
+		if name := path.Base(dir); !ciOperatorDirs[name] {
+			return name
+		}
+	}
+	return ""
+}
@@ -1,14 +1,13 @@
 package payload_processing
 
 import (
-	"encoding/xml"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
-	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 	"regexp"
 	"sort"
 	"strconv"
@@ -16,37 +15,111 @@ import (
 	"sync"
 	"time"
 
-	goutils "github.com/dperique/goutils"
+	"github.com/dperique/release-analysis/fetch"
+	"github.com/dperique/release-analysis/junit"
+	"github.com/dperique/release-analysis/logging"
+	"github.com/dperique/release-analysis/ownership"
+	"github.com/dperique/release-analysis/rules"
+	"github.com/dperique/release-analysis/terminal"
 )
 
 const (
-	red         = "\033[1;31m"
-	green       = "\033[1;32m"
-	purple      = "\033[1;34m"
-	cyan        = "\033[36m"
-	orange      = "\033[38;5;208m"
-	colorNone   = "\033[0m"
 	acceptedStr = "Accepted"
 	rejectedStr = "Rejected"
 	pendingStr  = "Pending"
 
 	// GCS message shown when an artifact is not available (the page exists but this text shows)
-	NOT_SERVING   = "The application is currently not serving requests at this endpoint. It may not have been started or is still starting"
-	maxChar       = 175
-	MAX_JOBS      = 10
-	MAX_TESTS     = 20
-	BODY_TIMEOUT  = 5
-	JUNIT_TIMEOUT = 50
+	NOT_SERVING = "The application is currently not serving requests at this endpoint. It may not have been started or is still starting"
 
 	// the release controller main page
 	releaseUrlPrefix = "https://amd64.ocp.releases.ci.openshift.org/"
 )
 
+// Limits and timeouts; the commands set them from the config file, environment or flags.
+var (
+	MAX_CHAR           = 175
+	MAX_JOBS           = 10
+	MAX_TESTS          = 20
+	BODY_TIMEOUT       = 5 * time.Second
+	JUNIT_TIMEOUT      = 50 * time.Second
+	JOB_DETAIL_TIMEOUT = 60 * time.Second // for all the sub-jobs of an aggregated job
+)
+
+// The colors are empty strings when color is off (see SetColor).
+var red, green, purple, cyan, orange, colorNone string
+
+func init() {
+	SetColor(true)
+}
+
+// SetColor turns the colors in the output on or off.
+func SetColor(on bool) {
+	if !on {
+		red, green, purple, cyan, orange, colorNone = "", "", "", "", "", ""
+		return
+	}
+	red = "\033[1;31m"
+	green = "\033[1;32m"
+	purple = "\033[1;34m"
+	cyan = "\033[36m"
+	orange = "\033[38;5;208m"
+	colorNone = "\033[0m"
+}
+
 var (
 	errDownloadTookTooLong = errors.New("download took too long")
 	regexTitle             = regexp.MustCompile(`\<.*title\>(.*)\<\/title\>`)
 )
 
+// TestRules decides which tests are hidden, reclassified (e.g., disruption) or annotated with a
+// bug link in both plain and aggregated output; the commands replace it with the --rules file.
+var TestRules = rules.Default()
+
+// applyTestRules applies TestRules to a test name and returns the verdict, the color to show
+// the test in and a note (class and bug link) to append to it.
+func applyTestRules(testName string) (rules.Verdict, string, string) {
+	verdict := TestRules.Classify(testName)
+	color := purple
+	note := ""
+	switch verdict.Class {
+	case rules.ClassDisruption:
+		color = orange
+	case rules.ClassInfra:
+		color = cyan
+		note = " [infra]"
+	case rules.ClassKnownBug:
+		color = green
+		note = " [known bug]"
+	}
+	if verdict.Bug != "" {
+		note += " " + verdict.Bug
+		if !verdict.Expires.IsZero() {
+			note += fmt.Sprintf(" (until %s)", verdict.Expires.Format("2006-01-02"))
+		}
+	}
+	return verdict, color, note
+}
+
+// SigMapping maps SIGs (and Jira components) to a component and team so we know whom to ping
+// about failing tests; the commands replace it with the --sig-map file.
+var SigMapping = &ownership.Mapping{}
+
+// ownershipLines groups failing tests by SIG and returns lines like
+// "5 failures: 3 sig-network, 2 sig-storage" followed by the components/teams of each SIG.
+func ownershipLines(testNames []string, indent string) []string {
+	if len(testNames) == 0 {
+		return nil
+	}
+	groups := SigMapping.GroupTests(testNames)
+	lines := []string{fmt.Sprintf("%s%s\n", indent, ownership.Summary(groups))}
+	for _, g := range groups {
+		if len(g.Components) > 0 {
+			lines = append(lines, fmt.Sprintf("%s  %s: %s\n", indent, g.Sig, strings.Join(g.Components, ", ")))
+		}
+	}
+	return lines
+}
+
 // jobSummaryLineRegex is used to extract info about a specific job run in a job-run-summary.html file
 var jobSummaryLineRegex = regexp.MustCompile(`\<li\>\<a target="_blank" href="(.*)"\>.*\</a\> build[0-9]+ (failure|success) after (.*)`)
 
@@ -64,26 +137,19 @@ func getJobStr(jobUrl, jobStatusFull, jobTime string) string {
 	for j := 0; j < scaleSeconds; j++ {
 		stars = stars + "*"
 	}
-	buildLogUrl := strings.Replace(jobUrl, "https://prow.ci.openshift.org/view/gs", "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs", 1)
-	prowJobJsonUrl := buildLogUrl + "/prowjob.json"
+	prowJobJsonUrl := gcsWebUrl(jobUrl) + "/prowjob.json"
 	buildFarmNum := getBuildFarmServer(prowJobJsonUrl)
-	return fmt.Sprintf("    %s %s %4s %8s %s", tailOfJobUrl[len(tailOfJobUrl)-1], buildFarmNum, jobStatus, jobTime, stars)
+	return fmt.Sprintf("    %s %s %4s %8s %s", terminal.Link(jobUrl, tailOfJobUrl[len(tailOfJobUrl)-1]), buildFarmNum, jobStatus, jobTime, stars)
 }
 
 // getBuildFarmServer takes a string which is the Url for the prowjob.json file from a prow job.  In this
 // file, there's a string like `"cluster": "build05"`, which has the build farm server name.  This
 // function finds that and returns it.
 func getBuildFarmServer(prowJobJsonUrl string) string {
+	start := time.Now()
 	body, err := getBodyTimeout(prowJobJsonUrl, BODY_TIMEOUT)
 	if err != nil {
-		fmt.Println("third part")
-		if err == errDownloadTookTooLong {
-			fmt.Println("Download problem 6")
-			goutils.CheckErrFatal(err)
-		} else {
-			fmt.Println("Other third error")
-			goutils.CheckErrFatal(err)
-		}
+		logDownloadError("getBuildFarmServer", prowJobJsonUrl, start, err)
 		return "build??"
 	}
 
@@ -98,65 +164,32 @@ func getBuildFarmServer(prowJobJsonUrl string) string {
 }
 
 // getBodyTimeout takes a url, and returns the body (i.e., contents).
-// This is the same thing you get when you do curl -sk url.
-// If timeout is exceeded during the ReadAll() call, return nil.
-// Any error is fatal except timeout.
-func getBodyTimeout(url string, timeout int) ([]byte, error) {
-	respCh := make(chan *http.Response, 1)
-	errCh := make(chan error, 1)
-	go func() {
-		resp, err := http.Get(url)
-		goutils.CheckErrFatal(err)
-		respCh <- resp
-		errCh <- err
-	}()
-	var resp *http.Response
-	var err error
-	select {
-	case <-time.After(time.Duration(timeout) * time.Second):
-		fmt.Println("Download problem doing http.Get()")
+// This is the same thing you get when you do curl -sk url except that anything other than
+// a 200 is an error (see fetch.StatusError).  The timeout is for each attempt; a download that
+// keeps timing out returns errDownloadTookTooLong.
+func getBodyTimeout(url string, timeout time.Duration) ([]byte, error) {
+	body, err := fetch.Get(context.Background(), url, timeout)
+	if errors.Is(err, context.DeadlineExceeded) {
 		return nil, errDownloadTookTooLong
-	case resp = <-respCh:
-		err = <-errCh
-		goutils.CheckErrFatal(err)
-	}
-	byteCh := make(chan []byte, 1)
-	go func() {
-		defer resp.Body.Close()
-		bytes, err := io.ReadAll(resp.Body)
-		goutils.CheckErrFatal(err)
-		byteCh <- bytes
-		errCh <- err
-	}()
-	select {
-	case <-time.After(time.Duration(timeout) * time.Second):
-		fmt.Println("Download problem doing io.ReadAll()")
-		return nil, errDownloadTookTooLong
-	case result := <-byteCh:
-		err := <-errCh
-		goutils.CheckErrFatal(err)
-		return result, err
 	}
+	return body, err
 }
 
-// getSummaryPrefix takes an aggregated job and gets the artifacts directory
-// prefix that will lead to its two summary files.
-func getSummaryPrefix(aggrJobUrl string) string {
-	// Depending on the gcs bucket name, we'll have to use a different pattern.
-	var pattern string
-	if strings.Contains(aggrJobUrl, "test-platform-results") {
-		pattern = `https://prow.ci.openshift.org/view/gs/test-platform-results/logs/`
-	} else {
-		pattern = `https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/`
+// openUrlTimeout takes a url and returns a reader for its body so it can be streamed (e.g.,
+// straight into the xml decoder) instead of held in memory or written to disk.
+// The timeout covers the whole download.
+func openUrlTimeout(url string, timeout time.Duration) (io.ReadCloser, error) {
+	body, err := fetch.Open(context.Background(), url, timeout)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, errDownloadTookTooLong
 	}
-
-	return strings.Replace(aggrJobUrl, pattern, "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/origin-ci-test/logs/", 1)
+	return body, err
 }
 
 // getSummaryUrl takes an aggregated job and returns the aggregation-testrun-summary.html
 // to be used to extract the test failures.
 func getSummaryUrl(aggrJobUrl string) string {
-	aggrSummaryPrefix := getSummaryPrefix(aggrJobUrl)
+	aggrSummaryPrefix := gcsWebUrl(aggrJobUrl)
 	aggrSummaryPostfix := "artifacts/release-analysis-aggregator/openshift-release-analysis-aggregator/artifacts/release-analysis-aggregator/aggregation-testrun-summary.html"
 	return fmt.Sprintf("%s/%s", aggrSummaryPrefix, aggrSummaryPostfix)
 }
@@ -164,7 +197,7 @@ func getSummaryUrl(aggrJobUrl string) string {
 // getJobSummaryUrl takes an aggregated job and returns the job-run-summary.html
 // to be used to extract job run times (and job run urls).
 func getJobSummaryUrl(aggrJobUrl string) string {
-	aggrSummaryPrefix := getSummaryPrefix(aggrJobUrl)
+	aggrSummaryPrefix := gcsWebUrl(aggrJobUrl)
 	aggrJobSummaryPostfix := "artifacts/release-analysis-aggregator/openshift-release-analysis-aggregator/artifacts/release-analysis-aggregator/job-run-summary.html"
 	return fmt.Sprintf("%s/%s", aggrSummaryPrefix, aggrJobSummaryPostfix)
 }
@@ -179,7 +212,7 @@ func createSortedDurations(output string) string {
 		tmp := strings.Replace(durationStr, "s", "", -1)
 		f, err := strconv.ParseFloat(tmp, 32)
 		if err != nil {
-			fmt.Println("Error parsing float: ", tmp)
+			slog.Warn("unable to parse disruption duration", "op", "createSortedDurations", "duration", tmp)
 			f = 99999.0
 		}
 		durationInt := int(math.Round(f))
@@ -195,95 +228,8 @@ func createSortedDurations(output string) string {
 	return output
 }
 
-// processJunit takes a gcs bucket url (junit subdir), downloads files that match the pattern,
-// to /tmp/jobId.  Specifically put these somewhere on the disk so you can look at them manually for
-// debugging.  When things work well, just keep the contents in memory (and notice memory size
-// increase).
-// returns a slice of those the filename for those files in /tmp/jobId
-// TODO refactor with the gcs_node_download program
-func processJunit(url, pattern string) []string {
-
-	// Extract the job id from the URL (as it is unique).
-	re := regexp.MustCompile(`\d{19}`)
-	matches := re.FindStringSubmatch(url)
-
-	if len(matches) == 0 {
-		fmt.Println("Unable to extract job id, falling back to /tmp")
-	}
-
-	jobId := matches[0]
-
-	// Get contents of the junit subdir.
-	//n := time.Now()
-	body, err := getBodyTimeout(url, BODY_TIMEOUT)
-	//fmt.Printf("time to download junit subdir contents: %s\n", time.Since(n))
-	if err != nil {
-		if err == errDownloadTookTooLong {
-			fmt.Println("Download problem 8")
-			goutils.CheckErrFatal(err)
-		}
-	}
-	fileList := strings.Split(string(body), "\n")
-
-	regExp1 := regexp.MustCompile(`^.*<a href=\"`)
-	regExp2 := regexp.MustCompile(`\"><.*$`)
-
-	filePatternRegex := regexp.MustCompile(pattern)
-	retVal := []string{}
-	for _, i := range fileList {
-		if strings.Contains(i, "gcs/origin-ci-test") {
-			line := regExp1.ReplaceAllString(i, "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com")
-			line = regExp2.ReplaceAllString(line, "")
-			lineParts := strings.Split(line, "/")
-			tmpDirPath := filepath.Join("/tmp", jobId)
-			fileName := filepath.Join(tmpDirPath, lineParts[len(lineParts)-1])
-			//fmt.Println("Debug: ", fileName)
-			//fileName := "/tmp/" + jobId + "/" + lineParts[len(lineParts)-1]
-
-			if !filePatternRegex.MatchString(fileName) {
-				//fmt.Printf("match check: %s %s\n", pattern, fileName)
-				continue
-			}
-			//fmt.Printf("  Getting: %s\n", fileName)
-			err := os.MkdirAll(tmpDirPath, 0755)
-			if err != nil {
-				fmt.Printf("Failed to create directory %s\n", tmpDirPath)
-				goutils.CheckErrFatal(err)
-			}
-			outputFile, err := os.Create(fileName)
-			if err != nil {
-				goutils.CheckErrFatal(err)
-			}
-
-			// Get the file contents.
-			// Note the timeout of 50 seconds; this is because those junit.xml file are
-			// sometimes in the 10M and 20M range.  GCS is probably throttling the speed
-			// at which we can download.
-			//n = time.Now()
-			body, err = getBodyTimeout(line, JUNIT_TIMEOUT)
-			//fmt.Printf("time to download junit file: %s\n", time.Since(n))
-			if err != nil {
-				if err == errDownloadTookTooLong {
-					fmt.Println("Download problem 9")
-					goutils.CheckErrFatal(err)
-				}
-			}
-
-			// Write the contents to file.
-			_, err = outputFile.Write(body)
-			goutils.CheckErrFatal(err)
-			_ = outputFile.Close()
-			retVal = append(retVal, fileName)
-		}
-	}
-	//fmt.Println("Done downloading")
-	// Include the directory for later deletion
-	retVal = append(retVal, jobId)
-	return retVal
-}
-
 // printPayloadTitles prints out a payload title containing its status, time and url (for failed payloads)
-func printPayloadTitles(showAllUrl bool, title string, payloadStatus string, payloadItem ReleasePayload) {
+func printPayloadTitles(w io.Writer, showAllUrl bool, title string, payloadStatus string, payloadItem ReleasePayload) {
 	var color string
 	var url string
 	switch payloadStatus {
@@ -303,29 +249,66 @@ func printPayloadTitles(showAllUrl bool, title string, payloadStatus string, pay
 			url = payloadItem.ReleaseURL
 		}
 	default:
-		fmt.Println("Unknown payloadStatus:", payloadStatus, " should be one of:", acceptedStr, rejectedStr)
+		slog.Warn("unknown payload status", "status", payloadStatus, "expected", []string{acceptedStr, rejectedStr}, "url", payloadItem.ReleaseURL)
 	}
 	if payloadItem.forced {
 		payloadStatus += "(f)"
 	}
 
-	fmt.Println()
-	fmt.Println("===============================================================================================================================================================================")
-	fmt.Println()
-	fmt.Printf("%s%s  %s %s %11s %16s   %s\n", color, title, payloadStatus, colorNone, payloadItem.timeStr, payloadItem.timeDetailStr, url)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, terminal.Separator())
+	fmt.Fprintln(w)
+	if terminal.Hyperlinks {
+		// The title is a link to the payload so there's no need to show the url.
+		title = terminal.Link(payloadItem.ReleaseURL, title)
+		url = ""
+	}
+	fmt.Fprintf(w, "%s%s  %s %s %11s %16s   %s\n", color, title, payloadStatus, colorNone, payloadItem.timeStr, payloadItem.timeDetailStr, url)
+}
+
+// blockingJob is a blocking job of a payload as listed on the payload's release page.
+type blockingJob struct {
+	name   string // e.g., aggregated-aws-ovn-upgrade-4.16-micro
+	url    string // the prow job
+	status string // Pending, Succeeded or Failed
 }
 
-// processPayloadItem takes a payload item (containing an URL for the release) and scrapes the page
-// to determine the pass/fail and aggregate job info and prints it.
+// blockingJobRegex matches a job on the release page: <a class... href=http... Pending|Succeeded|Failed</a>.
+var blockingJobRegex = regexp.MustCompile(`href="(.*)"\>(.*) (Pending.*|Succeeded.*|Failed.*)</a>.*`)
+
+// getBlockingJobs returns the blocking jobs on a payload's release page; false if there's no
+// "Blocking jobs" (e.g., the payload aged out and the page is gone).
+func getBlockingJobs(body string) ([]blockingJob, bool) {
+	// The text below "Blocking jobs" and before "Informing jobs" is the Blocking jobs (the
+	// part we care about).
+	tmp := strings.Split(body, `Blocking jobs`)
+	if len(tmp) < 2 {
+		return nil, false
+	}
+	ilines := strings.Split(tmp[1], `Informing jobs`)[0]
+
+	jobs := []blockingJob{}
+	for _, line := range strings.Split(ilines, `<li>`) {
+		list := blockingJobRegex.FindStringSubmatch(line)
+		if len(list) < 4 {
+			// Skip any other html element that doesn't match.
+			continue
+		}
+		jobs = append(jobs, blockingJob{name: strings.Trim(list[2], " "), url: list[1], status: list[3]})
+	}
+	return jobs, true
+}
+
+// ProcessPayloadItem takes a payload item (containing an URL for the release) and scrapes the page
+// to determine the pass/fail and aggregate job info and prints it to w.  It returns the names of
+// the tests that failed in the payload's jobs.
 //
 // showAllUrl, showAggrTimes, showSuccess are values of the parameters passed into the main function.
-func ProcessPayloadItem(payloadItem ReleasePayload, showAllUrl, showAggrTimes, showSuccess, printTestDetail, showAggrJobDetail bool) {
+func ProcessPayloadItem(w io.Writer, payloadItem ReleasePayload, showAllUrl, showAggrTimes, showSuccess, printTestDetail, showAggrJobDetail bool) []string {
+	start := time.Now()
 	body, err := getBodyTimeout(payloadItem.ReleaseURL, BODY_TIMEOUT*10)
 	if err != nil {
-		if err == errDownloadTookTooLong {
-			fmt.Println("Download problem 7")
-			goutils.CheckErrFatal(err)
-		}
+		logDownloadError("ProcessPayloadItem", payloadItem.ReleaseURL, start, err)
 	}
 	tlines := regexTitle.FindStringSubmatch(string(body))
 	var title string
@@ -335,12 +318,11 @@ func ProcessPayloadItem(payloadItem ReleasePayload, showAllUrl, showAggrTimes, s
 		title = "No release"
 	}
 
-	// The text below "Blocking jobs" is the Informing jobs.
-	tmp := strings.Split(string(body), `Blocking jobs`)
-	if len(tmp) < 2 {
+	jobs, found := getBlockingJobs(string(body))
+	if !found {
 		// If this happens, the payload webpage was most likely aged out (and deleted).
-		fmt.Println()
-		fmt.Println("===============================================================================================================================================================================")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, terminal.Separator())
 
 		titleParts := strings.Split(payloadItem.ReleaseURL, "/")
 		title = titleParts[len(titleParts)-1]
@@ -348,8 +330,13 @@ func ProcessPayloadItem(payloadItem ReleasePayload, showAllUrl, showAggrTimes, s
 		if payloadItem.forced {
 			displayedPhase += "(f)"
 		}
-		fmt.Printf("%s %s, %s\n", title, displayedPhase, payloadItem.ReleaseURL)
-		fmt.Println("  ", strings.Split(string(body), "\n")[0])
+		fmt.Fprintf(w, "%s %s, %s\n", title, displayedPhase, payloadItem.ReleaseURL)
+		if err != nil {
+			result := JobResult{Url: payloadItem.ReleaseURL, Status: statusOf(err), Artifact: payloadItem.ReleaseURL, Reason: reasonOf(err)}
+			fmt.Fprint(w, result.line("   "))
+		} else {
+			fmt.Fprintln(w, "  ", strings.Split(string(body), "\n")[0])
+		}
 
 		// Realize that you can still get the urls for the blocking jobs via this:
 		// sippy_openshift=> select url from release_job_runs join release_tags on release_tags.id = release_job_runs.release_tag_id where release_tags.release_tag='4.14.0-0.ci-2023-03-08-230640';
@@ -374,45 +361,26 @@ func ProcessPayloadItem(payloadItem ReleasePayload, showAllUrl, showAggrTimes, s
 		// https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/aggregated-azure-sdn-upgrade-4.14-minor-release-openshift-release-analysis-aggregator/1633606784306384896     | t
 		// https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/periodic-ci-openshift-release-master-ci-4.14-e2e-aws-sdn-serial/1633606785149440000                           | t
 
-		return
+		return nil
 	}
-	blines := tmp[1]
-
-	// The text before "Informing jobs" is the Blocking jobs (the part we care about).
-	ilines := strings.Split(blines, `Informing jobs`)[0]
-
-	// Operate on the blocking jobs one at a time.
-	// These will be a list of <a class... href=http... Pending|Succeeded|Failed</a>.
-	blockingJobsList := strings.Split(ilines, `<li>`)
-
 	var payloadStatus string
 
 	payloadStatus = acceptedStr
 
-	succeededOrFailed := regexp.MustCompile(`href="(.*)"\>(.*) (Pending.*|Succeeded.*|Failed.*)</a>.*`)
-
 	// The loop is done twice -- once to calculate if the payload was Accepted or Rejected,
 	// and once to print it out.
-	for _, line := range blockingJobsList {
-		list := succeededOrFailed.FindStringSubmatch(line)
-		if len(list) < 2 {
-			// Skip any other html element that doesn't match.
-			continue
-		}
-		status := list[3]
-		if status == "Failed" {
+	for _, job := range jobs {
+		if job.status == "Failed" {
 			payloadStatus = rejectedStr
 		}
-		if status == "Pending" {
+		if job.status == "Pending" {
 			payloadStatus = pendingStr
 		}
 	}
 
-	fmt.Println(payloadStatus)
+	slog.Debug("payload status", "url", payloadItem.ReleaseURL, "status", payloadStatus, "phase", payloadItem.phase)
 	// We already figured out the payload status earlier; but let's ensure they match.
 	if payloadStatus != payloadItem.phase {
-		goutils.CheckErrFatal(err)
-
 		// This happens when we force reject a payload and the jobs are still running (and in
 		// Pending state) so we wrongly conclude the payload is pending when it never finished,
 		// was force rejected and will never finish.
@@ -422,271 +390,203 @@ func ProcessPayloadItem(payloadItem ReleasePayload, showAllUrl, showAggrTimes, s
 	}
 
 	// Now that we know the payload status, print the payload title and status.
-	printPayloadTitles(showAllUrl, title, payloadStatus, payloadItem)
+	printPayloadTitles(w, showAllUrl, title, payloadStatus, payloadItem)
 
-	for _, line := range blockingJobsList {
-		list := succeededOrFailed.FindStringSubmatch(line)
-		if len(list) < 3 {
-			continue
-		}
-		payloadJobShortName := strings.Trim(list[2], " ")
+	// The payload tag (e.g., 4.16.0-0.nightly-2024-04-21-123456) is used to group failure signatures.
+	payloadName := path.Base(payloadItem.ReleaseURL)
+
+	// Keep the failing tests of each aggregated job so we can correlate them at the end.
+	aggrResults := map[string][]aggrTestResult{}
+
+	// Keep the status of each job so we can say how many couldn't be fully analyzed.
+	jobResults := []JobResult{}
+
+	// Keep the failing tests of all the jobs for the caller.
+	failedTestNames := []string{}
+
+	for _, job := range jobs {
+		payloadJobShortName := job.name
 
 		// Get the status and print only the ones that failed.
-		status := list[3]
+		status := job.status
 
 		if status == "Failed" || showSuccess {
 			if status == "Failed" {
-				fmt.Println(" ", payloadJobShortName, red, status, colorNone)
+				fmt.Fprintln(w, " ", terminal.Link(job.url, payloadJobShortName), red, status, colorNone)
 			}
 			if status == "Succeeded" {
-				fmt.Println(" ", payloadJobShortName, green, status, colorNone)
+				fmt.Fprintln(w, " ", terminal.Link(job.url, payloadJobShortName), green, status, colorNone)
 			}
 
 			if strings.HasPrefix(payloadJobShortName, "aggregated") {
 				// This looks like an aggregated job so extract the aggregated job url.
-				aggrJobUrl := list[1]
+				aggrJobUrl := job.url
 
 				// Goto the aggregated job and print out the failing tests
-				PrintAggrSummaryTests(aggrJobUrl, showAggrTimes, printTestDetail, showAggrJobDetail, payloadJobShortName)
+				failedTests, result := printAggrSummaryTests(w, aggrJobUrl, payloadName, showAggrTimes, printTestDetail, showAggrJobDetail)
+				aggrResults[payloadJobShortName] = failedTests
+				jobResults = append(jobResults, result)
+				for _, r := range failedTests {
+					failedTestNames = append(failedTestNames, r.name)
+				}
 			} else {
-				plainJobUrl := list[1]
-				output := PrintPlainSummaryTests(plainJobUrl, payloadJobShortName, true, printTestDetail, "")
+				plainJobUrl := job.url
+				output, failedTests, result := printPlainSummaryTests(w, plainJobUrl, payloadName, true, printTestDetail, "")
 				for _, line := range output {
-					fmt.Println(line)
+					fmt.Fprintln(w, line)
 				}
+				jobResults = append(jobResults, result)
+				failedTestNames = append(failedTestNames, failedTests...)
 			}
 		}
 	}
+	fmt.Fprint(w, statusSummary(jobResults, "  "))
+	printAggrCorrelation(w, aggrResults)
+	return failedTestNames
 }
 
-// printPlainSummaryTests takes the URL of a prow job and a short name and returns output
-// lines that represent the name of the tests that failed.
-// payloadJobShortName: used to determine where the junit xml files reside.
-// displayUrl: allows us to not display the url esp. when called for aggregated job processing
+// PrintPlainSummaryTests takes the URL of a prow job and returns output lines that represent the
+// name of the tests that failed along with the names themselves.  The junit xml files are found by walking the job's artifacts so
+// we don't need to know the layout of each kind of job.
+// displayUrl: allows us to not display the url (on w) esp. when called for aggregated job processing
 // printTestDetail: enables printing test failure output (it gets verbose so suppress most of the time)
 // extraSpace: depending on what calls this function, we may need more space to make the output look clean
-// If we have trouble parsing the xml file (e.g., bad character present), we return an error string so that
+// If we have trouble parsing an xml file (e.g., bad character present), we include an error string so that
 // when it's output, we can see something went wrong.
-func PrintPlainSummaryTests(plainJobUrl, payloadJobShortName string, displayUrl bool, printTestDetail bool, extraSpace string) []string {
-
-	type Property struct {
-		Name  string `xml:"name,attr"`
-		Value string `xml:"value,attr"`
-	}
-
-	type Failure struct {
-		Message string `xml:"message,attr"`
-		Content string `xml:",chardata"`
-	}
-
-	type Testcase struct {
-		Name      string   `xml:"name,attr"`
-		Time      string   `xml:"time,attr"`
-		Failure   *Failure `xml:"failure"`
-		SystemOut string   `xml:"system-out"`
-	}
-
-	type Testsuite struct {
-		XMLName   xml.Name   `xml:"testsuite"`
-		Name      string     `xml:"name,attr"`
-		Tests     string     `xml:"tests,attr"`
-		Skipped   string     `xml:"skipped,attr"`
-		Failures  string     `xml:"failures,attr"`
-		Time      string     `xml:"time,attr"`
-		Property  []Property `xml:"property"`
-		Testcases []Testcase `xml:"testcase"`
-	}
+func PrintPlainSummaryTests(w io.Writer, plainJobUrl string, displayUrl bool, printTestDetail bool, extraSpace string) ([]string, []string) {
+	output, failedTestNames, _ := printPlainSummaryTests(w, plainJobUrl, "", displayUrl, printTestDetail, extraSpace)
+	return output, failedTestNames
+}
 
-	type TestSuites struct {
-		XMLName   xml.Name    `xml:"testsuites"`
-		TestSuite []Testsuite `xml:"testsuite"`
-	}
+// printPlainSummaryTests does the work for PrintPlainSummaryTests and also returns the status of
+// the job (whether we could analyze it); payloadName (if known) is the payload the job ran for
+// so failure signatures can be grouped by payload.
+func printPlainSummaryTests(w io.Writer, plainJobUrl, payloadName string, displayUrl bool, printTestDetail bool, extraSpace string) ([]string, []string, JobResult) {
 
-	if strings.Contains(payloadJobShortName, "4.12") {
-		// Hack, maintenance item for every GA'ed release: when we convert to aggregated
-		// jobs on a GA'ed release to non-aggregated, the short name changes to
-		// "aws-ovn-upgrade-4.12-micro" (i.e., it will no longer have the string
-		// "aggregated" in it).  This tool was created around 4.13 time so we only
-		// have to deal with this in 4.12.
-		payloadJobShortName = strings.Split(payloadJobShortName, "-4.12")[0]
-	}
 	if displayUrl {
-		fmt.Println("   ", plainJobUrl)
-	}
-
-	// Form the path for where to find the junit xml file
-	junitXmlUrl := strings.Replace(plainJobUrl, "https://prow.ci.openshift.org/view/gs", "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs", 1)
-	fallbackXml := junitXmlUrl + "/artifacts"
-	usingFallback := false
-
-	if strings.HasPrefix(payloadJobShortName, "aggregated-") {
-		// Strip off the "aggregated-" and trim off the "4.x" to arrive at a proper shortname.
-		payloadJobShortName = strings.ReplaceAll(payloadJobShortName, "aggregated-", "")
-		payloadJobShortName = strings.Split(payloadJobShortName, "-4.")[0]
-	}
-
-	// Depending on the testName, the location of the junit xml file varies.
-	switch payloadJobShortName {
-	case "metal-ipi-sdn":
-	case "metal-ipi-ovn-ipv6":
-	case "e2e-metal-ipi-sdn":
-		junitXmlUrl += "/artifacts"
-		usingFallback = true
-	case "aws-ovn-fips":
-		junitXmlUrl += "/artifacts/e2e-aws-ovn-fips/openshift-e2e-test/artifacts/junit"
-	case "install-analysis-all":
-		// This one is similar to an aggregated job and has junit files scrattered about; implement it someday.
-		junitXmlUrl += "Do this someday"
-	default:
-		// for our tests that use openshift-e2e-test (the ones we care about on blocking jobs), this
-		// will be the location of the junit xml.
-		junitXmlUrl += fmt.Sprintf("/artifacts/e2e-%s/openshift-e2e-test/artifacts/junit", payloadJobShortName)
+		fmt.Fprintln(w, "   ", jobUrlStr(plainJobUrl))
 	}
 
-	// Look for the junit file in the directory we found.
-	xmlFiles := processJunit(junitXmlUrl, "xml")
-
-	// Track what files to close and cleanup
-	cleanupXmlFiles := xmlFiles
-	fileList := []*os.File{}
-
-	if len(xmlFiles) < 1 {
-		//fmt.Println(t)
-		//fmt.Println("    NO XML FILES FOUND; trying fallback")
-		xmlFiles = processJunit(fallbackXml, "xml")
-		cleanupXmlFiles = xmlFiles
-		usingFallback = true
+	// Find every junit xml file in the job's artifacts and decode them (in parallel).
+	jobGcsUrl := gcsWebUrl(plainJobUrl)
+	artifactsUrl := jobGcsUrl + "/artifacts/"
+	junitFiles, err := discoverJunitFiles(artifactsUrl)
+	if err != nil {
+		result := artifactResult(plainJobUrl, jobGcsUrl, artifactsUrl, err)
+		return []string{result.line("    " + extraSpace)}, nil, result
 	}
-	//fmt.Println(xmlFiles)
+	junitDocs := fetchJunitDocuments(plainJobUrl, junitFiles)
 
+	result := JobResult{Url: plainJobUrl, Status: JobOK}
 	failedTestOutput := []string{}
-	for _, xmlFile := range xmlFiles {
-		if !strings.Contains(xmlFile, ".xml") {
+	flakedTestOutput := []string{}
+	failedTestNames := []string{}
+	e2eFailureFound := false
+	for _, junitDoc := range junitDocs {
+		if junitDoc.err != nil {
+			// If we have trouble getting or parsing the xml file (e.g., bad character present),
+			// say so and keep going with the other files.
+			docResult := artifactResult(plainJobUrl, jobGcsUrl, junitDoc.file.url, junitDoc.err)
+			failedTestOutput = append(failedTestOutput, docResult.line("    "+extraSpace))
+			result = result.merge(docResult)
 			continue
 		}
-		file, err := os.Open(xmlFile)
-		if err != nil {
-			goutils.CheckErrFatal(err)
-			return []string{fmt.Sprintf("Unable to open xml file: %s", xmlFile)}
-		}
-		fileList = append(fileList, file)
-		var testsuite Testsuite
-		if usingFallback {
-			// metal and fallback mode have TestSuites ; we get the first Testsuite.
-			var testSuites TestSuites
-			if err := xml.NewDecoder(file).Decode(&testSuites); err != nil {
-				goutils.CheckErrFatal(err)
-				return []string{"Could not parse xml file 1"}
+		suites := junitDoc.suites
+		stepLabelShown := false
+
+		// Group the attempts of each test; a test with no passing attempt is a failure and a test
+		// with both failing and passing attempts is a flake (no matter how many attempts there were).
+		for _, test := range junit.Summarize(suites.TestCases()) {
+			status := test.Status()
+			if status != junit.StatusFailed && status != junit.StatusFlaked {
+				continue
 			}
-			testsuite = testSuites.TestSuite[0]
-		} else {
-			if err := xml.NewDecoder(file).Decode(&testsuite); err != nil {
-				goutils.CheckErrFatal(err)
-				return []string{"Could not parse xml file 2"}
+
+			// Some failures don't contribute to the analysis (see the rules) so skip them
+			// to keep the output useful.
+			verdict, failureColor, note := applyTestRules(test.Name)
+			if verdict.Hidden {
+				continue
 			}
-		}
-		//fmt.Println("Testsuite:")
-		//fmt.Printf("  Name: %s\n", testsuite.Name)
-		//fmt.Printf("  Tests: %s\n", testsuite.Tests)
-		//fmt.Printf("  Skipped: %s\n", testsuite.Skipped)
-		//fmt.Printf("  Failures: %s\n", testsuite.Failures)
-		//fmt.Printf("  Time: %s\n", testsuite.Time)
-
-		// Count how many of each test case there is; fail is len of 1,
-		// flake is len > 1.
-		m := make(map[string][]Testcase, len(testsuite.Testcases))
-		for _, testcase := range testsuite.Testcases {
-			m[testcase.Name] = append(m[testcase.Name], testcase)
-		}
-		for _, testcase := range testsuite.Testcases {
-			if testcase.Failure != nil {
-				isFailure := false
-				if len(m[testcase.Name]) == 1 {
-					// One case and failure output exists, implies failure.
-					isFailure = true
-				}
-				if len(m[testcase.Name]) == 2 {
-					// Two cases and failure output exists, might be a flake.
-					gotPass := false
-					for _, t := range m[testcase.Name] {
-						if t.Failure == nil {
-							gotPass = true
-						}
-					}
-					// If one of them was a pass, this is a flake
-					if !gotPass {
-						isFailure = true
-					}
-				}
-				if isFailure {
-
-					failureColor := purple
-					// NOTE: You have to do this check twice: once for aggregated job and once for plain jobs
-					if strings.Contains(testcase.Name, "disruption") || strings.Contains(testcase.Name, "Application behind service load balancer with PDB remains available using new connections") {
-						// Color disruption in orange
-						failureColor = orange
-					}
-
-					// The failure of these tests doesn't seem to contribute to the analysis so skip them
-					// to keep the output useful; in the future, we may show them.
-					if strings.Contains(testcase.Name, "observers-resource-watch container test") ||
-						strings.Contains(testcase.Name, "openshift-e2e-test container test") ||
-						strings.Contains(testcase.Name, "multi-stage test test phase") {
-						continue
-					}
-					failedTestOutput = append(failedTestOutput, fmt.Sprintf("    %s%sFailed: %s%s\n", extraSpace, failureColor, testcase.Name, colorNone))
-
-					if printTestDetail && strings.Contains(testcase.Name, "disruption") {
-						if len(testcase.Failure.Content) > 0 {
-							failedTestOutput = append(failedTestOutput, fmt.Sprintln("     ", extraSpace, strings.Split(testcase.Failure.Content, "\n")[0]))
-						} else if len(testcase.Failure.Message) > 0 {
-							failedTestOutput = append(failedTestOutput, fmt.Sprintln("     ", extraSpace, strings.Split(testcase.Failure.Message, "\n")[0]))
-						}
-					}
+
+			if status == junit.StatusFlaked {
+				line := fmt.Sprintf("      %sFlaked: %s (failed %d of %d attempts)%s", extraSpace, testLink(plainJobUrl, test.Name, test.Name), test.Failures, test.Attempts(), note)
+				flakedTestOutput = append(flakedTestOutput, terminal.Wrap(line, "        "+extraSpace)+"\n")
+				continue
+			}
+
+			if !stepLabelShown {
+				// Label the failures with the step whose junit file they came from.
+				failedTestOutput = append(failedTestOutput, fmt.Sprintf("    %s%s%s (%s)%s\n", extraSpace, cyan, junitDoc.file.step, path.Base(junitDoc.file.url), colorNone))
+				stepLabelShown = true
+			}
+			attemptsStr := ""
+			if test.Attempts() > 1 {
+				attemptsStr = fmt.Sprintf(" (failed %d attempts)", test.Attempts())
+			}
+			line := fmt.Sprintf("    %s%sFailed: %s%s%s%s", extraSpace, failureColor, testLink(plainJobUrl, test.Name, test.Name), colorNone, attemptsStr, note)
+			failedTestOutput = append(failedTestOutput, terminal.Wrap(line, "      "+extraSpace)+"\n")
+			failedTestNames = append(failedTestNames, test.Name)
+			if junitDoc.file.step != "ci-operator" {
+				e2eFailureFound = true
+			}
+
+			if printTestDetail {
+				failureText := test.Cases[0].FailureText()
+				if verdict.Class == rules.ClassDisruption && len(failureText) > 0 {
+					failedTestOutput = append(failedTestOutput, fmt.Sprintln("     ", extraSpace, strings.Split(failureText, "\n")[0]))
 				}
+
+				// Remember the failure so we can tell which failures share a root cause.
+				failureSignatures.add(failureText, test.Name, plainJobUrl, payloadName)
 			}
 		}
 	}
-	for i, cleanupFile := range cleanupXmlFiles {
-		if !strings.Contains(cleanupFile, ".xml") {
-			continue
-		}
-		//fmt.Println("Closing ", cleanupFile)
-		fileList[i].Close()
-		err := os.Remove(cleanupFile)
-		//fmt.Println("Done Closing ", cleanupFile)
-		if err != nil {
-			fmt.Println("Error deleting file:", err)
+
+	// Group the failures by SIG so we know whom to ping.
+	failedTestOutput = append(failedTestOutput, ownershipLines(failedTestNames, "    "+extraSpace)...)
+
+	// If the job failed before (or after) the tests ran (e.g., install or gather), there are no test
+	// failures to show so show which step failed instead.
+	if !e2eFailureFound {
+		steps := failedSteps(plainJobUrl, junitDocs)
+		if len(junitFiles) == 0 && len(steps) == 0 {
+			// Nothing we know how to read; don't pretend the job had no failures.
+			layoutResult := JobResult{Url: plainJobUrl, Status: JobUnsupportedLayout, Artifact: artifactsUrl, Reason: "no junit files or failed steps found"}
+			failedTestOutput = append(failedTestOutput, layoutResult.line("    "+extraSpace))
+			result = result.merge(layoutResult)
 		}
+		failedTestOutput = append(failedTestOutput, stepOutputLines(steps, extraSpace)...)
 	}
-	jobIdDirPath := filepath.Join("/tmp", cleanupXmlFiles[len(cleanupXmlFiles)-1])
-	err := os.RemoveAll(jobIdDirPath)
-	//fmt.Println("Remove dir: ", jobIdDirPath)
-	if err != nil {
-		fmt.Printf("Failed to remove directory %s: %s\n", jobIdDirPath, err)
+
+	// Flakes get their own section so we can see tests getting flakier before they start failing.
+	if len(flakedTestOutput) > 0 {
+		failedTestOutput = append(failedTestOutput, fmt.Sprintf("    %s%sFlaked: %d test(s)%s\n", extraSpace, cyan, len(flakedTestOutput), colorNone))
+		for i, line := range flakedTestOutput {
+			if i == MAX_TESTS {
+				failedTestOutput = append(failedTestOutput, fmt.Sprintf("      %s... and %d more\n", extraSpace, len(flakedTestOutput)-MAX_TESTS))
+				break
+			}
+			failedTestOutput = append(failedTestOutput, line)
+		}
 	}
-	return failedTestOutput
+	return failedTestOutput, failedTestNames, result
 }
 
-// getJobRunUrls takes an aggregated job and returns a list of the job run urls.
-func GetJobRunUrls(aggrJobUrl string) ([]string, error) {
+// GetJobRunUrls takes an aggregated job and returns a list of the job run urls (warning on w if
+// some are missing).
+func GetJobRunUrls(w io.Writer, aggrJobUrl string) ([]string, error) {
 	aggrJobSummaryUrl := getJobSummaryUrl(aggrJobUrl)
 
 	// The code below is identical to the one from printAggrSummaryTests
 	// except we don't need to go into each of the jobUrls.  This is a
 	// refactor opportunity so we keep the code looking almost identical.
 	// Get the html file for the aggregated job summary.
+	start := time.Now()
 	body, err := getBodyTimeout(aggrJobSummaryUrl, BODY_TIMEOUT)
 	if err != nil {
-		fmt.Println("Download problem in getJobRunUrls")
-		if err == errDownloadTookTooLong {
-			fmt.Println("Download took long for getJobRunUrls")
-			goutils.CheckErrFatal(err)
-		} else {
-			fmt.Println("Other error in download for getJobRunUrls")
-			goutils.CheckErrFatal(err)
-		}
-		return []string{}, fmt.Errorf("error getting job-run-sumary.html for %s", aggrJobUrl)
+		logDownloadError("GetJobRunUrls", aggrJobSummaryUrl, start, err)
+		return []string{}, fmt.Errorf("error getting job-run-summary.html for %s: %w", aggrJobUrl, err)
 	}
 
 	lines := strings.Split(string(body), "\n")
@@ -714,18 +614,120 @@ func GetJobRunUrls(aggrJobUrl string) ([]string, error) {
 		}
 	}
 	if !foundAllJobs {
-		fmt.Printf("    %sWarning: Got %d of %d jobs%s\n", red, actualJobCount, MAX_JOBS, colorNone)
+		fmt.Fprintf(w, "    %sWarning: Got %d of %d jobs%s\n", red, actualJobCount, MAX_JOBS, colorNone)
 	}
 	return retVal, nil
 }
 
-// printAggrSummaryTests prints out the failure summary for an aggregated job so you don't have to
-// click through to analyze its results.
+// The summary lines (below each failed test) in aggregation-testrun-summary.html.
+var (
+	summaryPattern            = regexp.MustCompile(`Passed (\d+) times, failed (\d+) times, skipped (\d+) times: we require at least one pass to consider it a success`)
+	summaryPattern2           = regexp.MustCompile(`Passed (\d+) times, failed (\d+) times, skipped (\d+) times: we require at least (\d+) attempts to have a chance at success`)
+	historicalSummaryPattern  = regexp.MustCompile(`Failed: Passed (\d+) times, failed (\d+) times.  The historical pass rate is (\d+)%.  The required number of passes is (\d+).`)
+	disruptionSummaryPattern  = regexp.MustCompile(`Failed: Passed (\d+) times, failed (\d+) times.  \(.*requiredPasses=(\d+).*\)`)
+	disruptionSummaryPattern2 = regexp.MustCompile(`Failed: Mean disruption of ([a-z-]+) is (\d+\.\d+) seconds is more than the failureThreshold`)
+	disruptionSummaryPattern3 = regexp.MustCompile(`\((P[0-9]+=[0-9\.]+s).* failures=\[(.*)\]`)
+)
+
+// aggrSummaryLine is what we got out of the summary line below a failed test.
+type aggrSummaryLine struct {
+	// text is the summary made easy on the eyes, e.g., pass=2/fail=8/req=6/skip=0.
+	text string
+	// known is false when none of the patterns matched (people change the disruption output).
+	known                            bool
+	passed, failed, skipped          int
+	requiredPasses, requiredAttempts int
+	historicalPassRate               int
+	disruption                       *Disruption
+}
+
+// parseAggrSummaryLine parses the summary line below a failed test in
+// aggregation-testrun-summary.html.
+func parseAggrSummaryLine(summary string) aggrSummaryLine {
+	summary = strings.Replace(summary, "<p>", "", 1)
+	summary = strings.Replace(summary, "</p>", "", 1)
+
+	var s aggrSummaryLine
+	var m []string
+	if m = summaryPattern.FindStringSubmatch(summary); len(m) > 1 {
+		s.passed, _ = strconv.Atoi(m[1])
+		s.failed, _ = strconv.Atoi(m[2])
+		s.skipped, _ = strconv.Atoi(m[3])
+		s.text = fmt.Sprintf("pass=%d/fail=%d/skip=%d", s.passed, s.failed, s.skipped)
+
+		// "we require at least one pass"
+		s.requiredPasses = 1
+
+	} else if m = summaryPattern2.FindStringSubmatch(summary); len(m) > 1 {
+		s.passed, _ = strconv.Atoi(m[1])
+		s.failed, _ = strconv.Atoi(m[2])
+		s.skipped, _ = strconv.Atoi(m[3])
+		s.requiredAttempts, _ = strconv.Atoi(m[4])
+		s.text = fmt.Sprintf("pass=%d/fail=%d/req=%d/skip=%d", s.passed, s.failed, s.requiredAttempts, s.skipped)
+
+	} else if m = historicalSummaryPattern.FindStringSubmatch(summary); len(m) > 1 {
+		s.passed, _ = strconv.Atoi(m[1])
+		s.failed, _ = strconv.Atoi(m[2])
+		s.historicalPassRate, _ = strconv.Atoi(m[3])
+		s.requiredPasses, _ = strconv.Atoi(m[4])
+		s.text = fmt.Sprintf("pass=%d/fail=%d/req=%d  historical=%d%%", s.passed, s.failed, s.requiredPasses, s.historicalPassRate)
+
+	} else if m = disruptionSummaryPattern3.FindStringSubmatch(summary); len(m) > 1 {
+		// The output will show [ jobId=7s jobId=9s ... ]
+		pNumber := m[1]
+		output := m[2]
+		s.failed = len(strings.Fields(output))
+		s.text = fmt.Sprintf("pass=0/fail=10/req=? disruption, %s, %s", pNumber, createSortedDurations(output))
+		statistic, seconds, _ := strings.Cut(pNumber, "=")
+		value, err := strconv.ParseFloat(strings.TrimSuffix(seconds, "s"), 64)
+		if bm := disruptionBackendRegex.FindStringSubmatch(summary); len(bm) > 1 && err == nil {
+			s.disruption = &Disruption{Backend: bm[1], Statistic: statistic, Seconds: value}
+		}
+
+	} else if m = disruptionSummaryPattern.FindStringSubmatch(summary); len(m) > 1 {
+		s.passed, _ = strconv.Atoi(m[1])
+		s.failed, _ = strconv.Atoi(m[2])
+		s.requiredPasses, _ = strconv.Atoi(m[3])
+		s.text = fmt.Sprintf("pass=%d/fail=%d/req=%d disruption", s.passed, s.failed, s.requiredPasses)
+		// If it's significantly later than Mar 20, 2023 and this never shows up, consider
+		// removing this pattern.
+		slog.Debug("old disruption pattern matched", "summary", summary)
+
+	} else if m = disruptionSummaryPattern2.FindStringSubmatch(summary); len(m) > 1 {
+		deviation := m[2]
+		s.text = fmt.Sprintf("pass=?/fail=?/req=? dev=%s disruption", deviation)
+		if value, err := strconv.ParseFloat(deviation, 64); err == nil {
+			s.disruption = &Disruption{Backend: m[1], Statistic: "mean", Seconds: value}
+		}
+
+	} else {
+		s.text = fmt.Sprintf("%s (?disruption)", summary)
+		return s
+	}
+	s.known = true
+	return s
+}
+
+// PrintAggrSummaryTests prints out the failure summary for an aggregated job (to w) so you don't
+// have to click through to analyze its results.  It returns the names of the failing tests.
 // aggrJobUrl: the url for the aggregated job
 // showAggrTimes: allows us to print how long each underlying job took (including an asterisk graph)
 // printTestDetail: allows us to print out test failure output (it gets verbose so suppress if needed)
-// payloadJobShortName: short name used by processJunit function to determine location of junit.xml files
-func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetail bool, showAggrJobDetail bool, payloadJobShortName string) {
+// showAggrJobDetail: allows us to print out the failing tests of each underlying job that failed
+func PrintAggrSummaryTests(w io.Writer, aggrJobUrl string, showAggrTimes bool, printTestDetail bool, showAggrJobDetail bool) []string {
+	failedTests, _ := printAggrSummaryTests(w, aggrJobUrl, "", showAggrTimes, printTestDetail, showAggrJobDetail)
+	failedTestNames := []string{}
+	for _, r := range failedTests {
+		failedTestNames = append(failedTestNames, r.name)
+	}
+	return failedTestNames
+}
+
+// printAggrSummaryTests does the work for PrintAggrSummaryTests and returns the failing tests
+// it scraped so callers (e.g., ProcessPayloadItem) can correlate them across aggregated jobs
+// along with the status of the aggregated job.
+// payloadName (if known) is the payload the aggregated job ran for.
+func printAggrSummaryTests(w io.Writer, aggrJobUrl, payloadName string, showAggrTimes bool, printTestDetail bool, showAggrJobDetail bool) ([]aggrTestResult, JobResult) {
 
 	// Get the aggregation prefix summary html file
 	// aggrSummaryPrefix := strings.Replace(aggrJobUrl, "https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/", "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/origin-ci-test/logs/", 1)
@@ -735,29 +737,23 @@ func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetai
 	// aggrJobSummaryUrl := fmt.Sprintf("%s/%s", aggrSummaryPrefix, aggrJobSummaryPostfix)
 	aggrSummaryUrl := getSummaryUrl(aggrJobUrl)
 	aggrJobSummaryUrl := getJobSummaryUrl(aggrJobUrl)
-	fmt.Println("   ", aggrJobUrl)
+	jobGcsUrl := gcsWebUrl(aggrJobUrl)
+	fmt.Fprintln(w, "   ", jobUrlStr(aggrJobUrl))
 	//fmt.Println("     ", aggrSummaryUrl)
 
 	// Get the html file for the aggregated job summary.
+	start := time.Now()
 	body, err := getBodyTimeout(aggrSummaryUrl, BODY_TIMEOUT)
+	if err == nil && strings.Contains(string(body), NOT_SERVING) {
+		err = errNotServing
+	}
 	if err != nil {
-		fmt.Println("first part")
-		if err == errDownloadTookTooLong {
-			fmt.Println("Download problem 4")
-			goutils.CheckErrFatal(err)
-		} else {
-			fmt.Println("Other error")
-			goutils.CheckErrFatal(err)
-		}
-		return
+		logDownloadError("printAggrSummaryTests", aggrSummaryUrl, start, err)
+		result := artifactResult(aggrJobUrl, jobGcsUrl, aggrSummaryUrl, err)
+		fmt.Fprint(w, result.line("    "))
+		return nil, result
 	}
-
-	summaryPattern := regexp.MustCompile(`Passed (\d+) times, failed (\d+) times, skipped (\d+) times: we require at least one pass to consider it a success`)
-	summaryPattern2 := regexp.MustCompile(`Passed (\d+) times, failed (\d+) times, skipped (\d+) times: we require at least (\d+) attempts to have a chance at success`)
-	historicalSummaryPattern := regexp.MustCompile(`Failed: Passed (\d+) times, failed (\d+) times.  The historical pass rate is (\d+)%.  The required number of passes is (\d+).`)
-	disruptionSummaryPattern := regexp.MustCompile(`Failed: Passed (\d+) times, failed (\d+) times.  \(.*requiredPasses=(\d+).*\)`)
-	disruptionSummaryPattern2 := regexp.MustCompile(`Failed: Mean disruption of ([a-z-]+) is (\d+\.\d+) seconds is more than the failureThreshold`)
-	disruptionSummaryPattern3 := regexp.MustCompile(`\((P[0-9]+=[0-9\.]+s).* failures=\[(.*)\]`)
+	result := JobResult{Url: aggrJobUrl, Status: JobOK}
 
 	// Scrape the failed tests from the html file.
 	lines := strings.Split(string(body), "\n")
@@ -770,6 +766,8 @@ func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetai
 	foundPassOrSkipped := false
 	disruptionFailureCount := 0
 	totalFailures := 0
+	failedTests := []aggrTestResult{}
+	truncated := false
 	for i := 0; i < len(lines); i++ {
 		maxTestIncr := 1
 		//fmt.Printf("line => %s\n", lines[i])
@@ -777,86 +775,52 @@ func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetai
 			foundFailures = true
 			failTestStr := strings.Replace(lines[i], "<b>", "", 1)
 			failTestStr = strings.Replace(failTestStr, "</b>", "", 1)
-			if len(failTestStr) > maxChar {
-				failTestStr = failTestStr[:maxChar]
-			}
-			color := purple
-			// NOTE: You have to do this check twice: once for aggregated job and once for plain jobs
-			if strings.Contains(failTestStr, "disruption") || strings.Contains(failTestStr, "Application behind service load balancer with PDB remains available using new connections") {
 
+			// The rules are the same ones used for plain jobs.
+			testName := strings.TrimPrefix(failTestStr, "Failed: ")
+			verdict, color, note := applyTestRules(testName)
+			if verdict.Hidden {
+				// Skip the summary line too.
+				i++
+				continue
+			}
+			// Long names are wrapped to the terminal; they're only cut when we don't know its width.
+			shownName := testName
+			if terminal.Width == 0 && len(failTestStr) > MAX_CHAR {
+				failTestStr = failTestStr[:MAX_CHAR]
+				shownName = strings.TrimPrefix(failTestStr, "Failed: ")
+			}
+			if verdict.Class == rules.ClassDisruption {
 				// Since disruption is being difficult lately, let's not count them for max tests.
 				// This way, we can see if all failures are disruption related.
-				// Set the color to orange.
 				maxTestIncr = 0
 				disruptionFailureCount++
-				color = orange
 			}
-			fmt.Printf("    %s%s%s\n", color, failTestStr, colorNone)
+			line := fmt.Sprintf("    %sFailed: %s%s%s", color, testLink(aggrJobUrl, testName, shownName), colorNone, note)
+			fmt.Fprintln(w, terminal.Wrap(line, "      "))
 			totalFailures++
 
 			// The next line is the summary for this test.
-			failStr := strings.Replace(lines[i+1], "<p>", "", 1)
-			failStr = strings.Replace(failStr, "</p>", "", 1)
-
-			// Summarize the pass/fail/historical line to be easy on the eyes.
-			var passed, failed, skipped, historicalPassRate, requiredPasses int
-			var m []string
-			if m = summaryPattern.FindStringSubmatch(failStr); len(m) > 1 {
-				passed, _ = strconv.Atoi(m[1])
-				failed, _ = strconv.Atoi(m[2])
-				skipped, _ = strconv.Atoi(m[3])
-				failStr = fmt.Sprintf("pass=%d/fail=%d/skip=%d", passed, failed, skipped)
-
-			} else if m = summaryPattern2.FindStringSubmatch(failStr); len(m) > 1 {
-				passed, _ = strconv.Atoi(m[1])
-				failed, _ = strconv.Atoi(m[2])
-				skipped, _ = strconv.Atoi(m[3])
-				requiredPasses, _ = strconv.Atoi(m[4])
-				failStr = fmt.Sprintf("pass=%d/fail=%d/req=%d/skip=%d", passed, failed, requiredPasses, skipped)
-
-			} else if m = historicalSummaryPattern.FindStringSubmatch(failStr); len(m) > 1 {
-				passed, _ = strconv.Atoi(m[1])
-				failed, _ = strconv.Atoi(m[2])
-				historicalPassRate, _ = strconv.Atoi(m[3])
-				requiredPasses, _ = strconv.Atoi(m[4])
-				failStr = fmt.Sprintf("pass=%d/fail=%d/req=%d  historical=%d%%", passed, failed, requiredPasses, historicalPassRate)
-
-			} else if m = disruptionSummaryPattern3.FindStringSubmatch(failStr); len(m) > 1 {
-				// The output will show [ jobId=7s jobId=9s ... ]
-				pNumber := m[1]
-				output := m[2]
-				failStr = fmt.Sprintf("pass=0/fail=10/req=? disruption, %s, %s", pNumber, createSortedDurations(output))
-
-			} else if m = disruptionSummaryPattern.FindStringSubmatch(failStr); len(m) > 1 {
-				passed, _ = strconv.Atoi(m[1])
-				failed, _ = strconv.Atoi(m[2])
-				requiredPasses, _ = strconv.Atoi(m[3])
-				failStr = fmt.Sprintf("pass=%d/fail=%d/req=%d disruption", passed, failed, requiredPasses)
-				fmt.Println("If you see the old disruption pattern getting matched, consider keeping it")
-				fmt.Println("If it's significantly later than Mar 20, 2023, then consider removing this pattern")
-
-			} else if m = disruptionSummaryPattern2.FindStringSubmatch(failStr); len(m) > 1 {
-				deviation := m[2]
-				failStr = fmt.Sprintf("pass=?/fail=?/req=? dev=%s disruption", deviation)
-
-			} else {
-				//fmt.Println("No match for summary line")
-				//fmt.Println("We got: ", failStr)
-				failStr = fmt.Sprintf("%s (?disruption)", failStr)
-
-				// People who mess with the disruption output wack our regex so color these
-				// bad lines as disruption.
-				if strings.HasPrefix(failStr, "suite=[BackendDisruption") {
-					disruptionFailureCount++
-				}
-				color = orange
+			summary := parseAggrSummaryLine(lines[i+1])
+			if !summary.known && strings.HasPrefix(summary.text, "suite=[BackendDisruption") {
+				// People who mess with the disruption output wack our regex so these bad lines
+				// are counted (and ranked) as disruption.
+				disruptionFailureCount++
 			}
 
-			fmt.Println("     ", failStr)
+			fmt.Fprintln(w, "     ", summary.text)
+			failedTests = append(failedTests, aggrTestResult{
+				name:           testName,
+				passed:         summary.passed,
+				failed:         summary.failed,
+				requiredPasses: summary.requiredPasses,
+				disruption:     verdict.Class == rules.ClassDisruption || !summary.known,
+			})
 			if testsPrinted > MAX_TESTS {
 				// If we already printed MAX_TESTS tests, we really need to just look at the prow job.
 				// A summary greater than MAX_TESTS is just be too big for a human to want to look.
-				fmt.Println("\n", " ", red, "THERE ARE MORE THAN", MAX_TESTS, " *********************************\n", colorNone)
+				fmt.Fprintln(w, "\n", " ", red, "THERE ARE MORE THAN", MAX_TESTS, " *********************************\n", colorNone)
+				truncated = true
 				break
 			}
 			testsPrinted += maxTestIncr
@@ -865,40 +829,44 @@ func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetai
 		if strings.HasPrefix(lines[i], "Skipped:") || strings.HasPrefix(lines[i], "Passed") {
 			foundPassOrSkipped = true
 		}
-		if strings.Contains(lines[i], NOT_SERVING) {
-			fmt.Println("    Aggregated job summary unavailable")
-			//fmt.Println("   ", aggrSummaryUrl)
-		}
 	}
 	if !foundFailures && !foundPassOrSkipped {
-		// We didn't find any failures or passes/skips so most likely never got a genuine aggregation-testrun-summary.html so warn the user.
-		fmt.Println(red, "   No failures found (aggregation-testrun-summary.html is probably missing)", colorNone)
+		// We didn't find any failures or passes/skips so this is not a genuine aggregation-testrun-summary.html.
+		result = JobResult{Url: aggrJobUrl, Status: JobUnsupportedLayout, Artifact: aggrSummaryUrl, Reason: "no test results found"}
+		fmt.Fprint(w, result.line("    "))
 	}
+	if len(failedTests) > 0 {
+		failedTestNames := []string{}
+		for _, r := range failedTests {
+			failedTestNames = append(failedTestNames, r.name)
+		}
+		fmt.Fprintln(w)
+		for _, line := range ownershipLines(failedTestNames, "    ") {
+			fmt.Fprint(w, line)
+		}
+	}
+	printDistanceToPass(w, failedTests, truncated)
 
 	if !showAggrTimes {
-		return
+		return failedTests, result
 	}
 
 	if disruptionFailureCount > 0 {
-		fmt.Println()
-		fmt.Printf("    %s%s %d/%d%s\n", red, "Disruption failure count:", disruptionFailureCount, totalFailures, colorNone)
-		fmt.Println()
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "    %s%s %d/%d%s\n", red, "Disruption failure count:", disruptionFailureCount, totalFailures, colorNone)
+		fmt.Fprintln(w)
 	}
 
 	// Print out the run times of each job (full complete runs ~3 hours)
 
 	// Get the html file for the aggregated job summary.
+	start = time.Now()
 	body, err = getBodyTimeout(aggrJobSummaryUrl, BODY_TIMEOUT)
 	if err != nil {
-		fmt.Println("second part")
-		if err == errDownloadTookTooLong {
-			fmt.Println("Download problem 5")
-			goutils.CheckErrFatal(err)
-		} else {
-			fmt.Println("Other error")
-			goutils.CheckErrFatal(err)
-		}
-		return
+		logDownloadError("printAggrSummaryTests", aggrJobSummaryUrl, start, err)
+		jobSummaryResult := artifactResult(aggrJobUrl, jobGcsUrl, aggrJobSummaryUrl, err)
+		fmt.Fprint(w, jobSummaryResult.line("    "))
+		return failedTests, result.merge(jobSummaryResult)
 	}
 
 	lines = strings.Split(string(body), "\n")
@@ -919,7 +887,7 @@ func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetai
 	foundAllJobs := false
 	for i := 0; i < len(lines); i++ {
 		if i == 25 {
-			fmt.Println()
+			fmt.Fprintln(w)
 		}
 		m := jobSummaryLineRegex.FindStringSubmatch(lines[i])
 		if len(m) > 1 {
@@ -940,7 +908,7 @@ func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetai
 		}
 	}
 	if !foundAllJobs {
-		fmt.Printf("    %sWarning: Got %d of %d jobs%s\n", red, actualJobCount, MAX_JOBS, colorNone)
+		fmt.Fprintf(w, "    %sWarning: Got %d of %d jobs%s\n", red, actualJobCount, MAX_JOBS, colorNone)
 	}
 
 	// Wait until all of them are done and then close the channel; we need to do this
@@ -952,20 +920,27 @@ func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetai
 	// When we parse out individual job results, it's slow becaues the junit.xml files and sometimes
 	// big.  So, we launch a go routine for each and show the output lines as they come in; this way
 	// the output can progress vs. always waiting for the slowest one and having the longest pause.
-	jobOutputCh := make(chan []string, MAX_JOBS)
+	// The status of each job we looked into counts toward the aggregated job's status.
+	type jobOutput struct {
+		lines  []string
+		result JobResult
+	}
+	jobOutputCh := make(chan jobOutput, MAX_JOBS)
 	counter := 0
 	for jobInfoItem := range jobInfoCh {
 		//fmt.Println("Launch: ", counter)
 		counter++
 		go func(jj jobInfo) {
-			output := []string{
-				jj.jobSummary,
-				"\n",
+			output := jobOutput{
+				lines:  []string{jj.jobSummary, "\n"},
+				result: JobResult{Url: jj.jobUrl, Status: JobOK},
 			}
 
 			if strings.Contains(jj.jobSummary, "fail") && showAggrJobDetail {
 				// For jobs that failed, print out what tests failed.
-				output = append(output, PrintPlainSummaryTests(jj.jobUrl, payloadJobShortName, false, printTestDetail, "  ")...)
+				lines, _, result := printPlainSummaryTests(w, jj.jobUrl, payloadName, false, printTestDetail, "  ")
+				output.lines = append(output.lines, lines...)
+				output.result = result
 			}
 			jobOutputCh <- output
 		}(jobInfoItem)
@@ -973,21 +948,28 @@ func PrintAggrSummaryTests(aggrJobUrl string, showAggrTimes bool, printTestDetai
 
 	// We know exactly how many jobs there are (not always 10) so wait for this many.
 	i := actualJobCount
-	const waitSeconds = 60
-	timeout := time.After(waitSeconds * time.Second)
+	timeout := time.After(JOB_DETAIL_TIMEOUT)
 
 	for i > 0 {
 		select {
-		case outputLines := <-jobOutputCh:
+		case output := <-jobOutputCh:
 			i--
-			for _, line := range outputLines {
-				fmt.Printf("%s", line)
+			for _, line := range output.lines {
+				fmt.Fprintf(w, "%s", line)
 			}
+			result = result.merge(output.result)
 		case <-timeout:
-			fmt.Printf("Took greater than %ds to show job details; skipping ...\n", waitSeconds)
+			timeoutResult := JobResult{Url: aggrJobUrl, Status: JobTimedOut, Reason: fmt.Sprintf("took more than %s to show the job details of %d job(s); skipping", JOB_DETAIL_TIMEOUT, i)}
+			fmt.Fprint(w, timeoutResult.line("    "))
+			result = result.merge(timeoutResult)
 			i = 0
 		}
 	}
-	close(jobOutputCh)
-	fmt.Println()
+	fmt.Fprintln(w)
+	return failedTests, result
+}
+
+// logDownloadError logs that getting url failed; op is what we were doing.
+func logDownloadError(op, url string, start time.Time, err error) {
+	slog.Warn("download failed", "op", op, "url", url, logging.Elapsed(start), "err", err)
 }
@@ -0,0 +1,70 @@
+package payload_processing
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dperique/release-analysis/fetch"
+)
+
+// cannedTransport answers the urls it has with their body and anything else with a 404.
+type cannedTransport map[string]string
+
+func (c cannedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := c[req.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		status, body = http.StatusNotFound, "not found"
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+// useCanned makes the Default client answer from pages until the test ends.
+func useCanned(t *testing.T, pages map[string]string) {
+	t.Helper()
+	saved := fetch.Default
+	t.Cleanup(func() { fetch.Default = saved })
+	config := fetch.DefaultConfig
+	config.Transport = cannedTransport(pages)
+	config.MaxRetries = 0
+	fetch.Default = fetch.New(config)
+}
+
+func TestAggrSummaryWithoutColor(t *testing.T) {
+	SetColor(false)
+	t.Cleanup(func() { SetColor(true) })
+
+	const aggrJobUrl = "https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/aggregated-aws-ovn-upgrade-4.16-micro-release-openshift-release-analysis-aggregator/1782000000000000001"
+	useCanned(t, map[string]string{getSummaryUrl(aggrJobUrl): `<html>
+Failed: <b>[sig-network] pods should successfully create sandboxes by other</b>
+<p>Passed 0 times, failed 10 times, skipped 0 times: we require at least one pass to consider it a success</p>
+Failed: <b>[sig-network] disruption/ingress-to-oauth-server connection/new should be available throughout the test</b>
+<p>Failed: Mean disruption of ingress-to-oauth-server is 12.30 seconds is more than the failureThreshold</p>
+Failed: <b>[sig-cli] oc explain should contain proper fields description for special types</b>
+<p>some summary line nobody has seen before</p>
+Passed: <b>[sig-node] pods</b>
+</html>
+`})
+
+	results, result := printAggrSummaryTests(io.Discard, aggrJobUrl, "", false, false, false)
+	if result.Status != JobOK {
+		t.Fatalf("expected the job to be analyzed, got %+v", result)
+	}
+	// Whether a test is disruption comes from the rules and the summary line, not the color it's
+	// printed in (which is "" for every test without color).
+	want := map[string]bool{
+		"[sig-network] pods should successfully create sandboxes by other":                                        false,
+		"[sig-network] disruption/ingress-to-oauth-server connection/new should be available throughout the test": true,
+		"[sig-cli] oc explain should contain proper fields description for special types":                         true,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d failed tests, got %+v", len(want), results)
+	}
+	for _, r := range results {
+		if disruption, ok := want[r.name]; !ok || r.disruption != disruption {
+			t.Errorf("%s: expected disruption=%v, got %v", r.name, disruption, r.disruption)
+		}
+	}
+}
@@ -1,11 +1,34 @@
 package releaseanalysiscommands
 
 import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/dperique/release-analysis/cache"
+	"github.com/dperique/release-analysis/config"
+	"github.com/dperique/release-analysis/fetch"
 	"github.com/dperique/release-analysis/job_analysis"
+	"github.com/dperique/release-analysis/job_history"
+	"github.com/dperique/release-analysis/logging"
 	"github.com/dperique/release-analysis/payload"
+	"github.com/dperique/release-analysis/payload_processing"
+	"github.com/dperique/release-analysis/serve"
+	"github.com/dperique/release-analysis/terminal"
 	"github.com/spf13/cobra"
 )
 
+var (
+	noCache    bool
+	recordDir  string
+	replayDir  string
+	verbose    bool
+	configFile string
+)
+
+// rootSettings are the config settings that can also be given as flags to every command.
+var rootSettings = []string{"log-level", "log-format", "color", "body-timeout", "junit-timeout", "job-detail-timeout", "max-jobs", "max-tests", "max-char"}
+
 // CreateRelContCommand adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func CreateRelContCommand() *cobra.Command {
@@ -15,9 +38,109 @@ func CreateRelContCommand() *cobra.Command {
 		Use:   "release-analysis view",
 		Short: "view payload or analysis",
 		Long:  `We can view payload or analysis of release-controller or prowjobs`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			mustExist := setConfigPath(cmd)
+			if err := config.Load(config.Path, mustExist); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if verbose {
+				config.Current.LogLevel = "debug"
+				config.Sources["log-level"] = "flag"
+			}
+			if err := logging.Setup(os.Stderr, config.Current.LogLevel, config.Current.LogFormat); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if err := terminal.Setup(config.Current.Color); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			applySettings()
+
+			// Recording and replaying bypass the cache so that what is recorded (or replayed) is
+			// exactly what the tool fetched.
+			switch {
+			case recordDir != "" && replayDir != "":
+				slog.Error("use either --record or --replay, not both")
+				os.Exit(1)
+			case recordDir != "":
+				transport, err := fetch.NewRecordTransport(recordDir)
+				if err != nil {
+					slog.Error("unable to record", "dir", recordDir, "err", err)
+					os.Exit(1)
+				}
+				fetch.UseTransport(transport)
+				return
+			case replayDir != "":
+				transport, err := fetch.NewReplayTransport(replayDir)
+				if err != nil {
+					slog.Error("unable to replay", "dir", replayDir, "err", err)
+					os.Exit(1)
+				}
+				fetch.UseTransport(transport)
+				return
+			}
+
+			// Cache what we download unless asked not to (or we're not downloading anything).
+			if noCache || cmd.HasParent() && (cmd.Parent().Name() == "cache" || cmd.Parent().Name() == "config") {
+				return
+			}
+			if _, err := fetch.EnableCache(cache.Dir); err != nil {
+				slog.Warn("unable to use the cache (continuing without it)", "dir", cache.Dir, "err", err)
+			}
+		},
+	}
+
+	defaultCacheDir, err := fetch.DefaultCacheDir()
+	if err != nil {
+		defaultCacheDir = ".release-analysis-cache"
 	}
+	defaultConfigPath, err := config.DefaultPath()
+	if err != nil {
+		defaultConfigPath = ".release-analysis.yaml"
+	}
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", defaultConfigPath, "Config file with defaults and tuning (see 'config view'); also "+config.EnvPrefix+"CONFIG")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log every download (same as --log-level=debug)")
+	for _, name := range rootSettings {
+		rootCmd.PersistentFlags().AddFlag(config.Flag(name))
+	}
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Don't use the on-disk cache of downloaded artifacts")
+	rootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "Save every HTTP response in this directory (so it can be replayed with --replay)")
+	rootCmd.PersistentFlags().StringVar(&replayDir, "replay", "", "Serve HTTP responses saved by --record from this directory instead of the network")
+	rootCmd.PersistentFlags().StringVar(&cache.Dir, "cache-dir", defaultCacheDir, "Directory for the on-disk cache of downloaded artifacts")
 
 	rootCmd.AddCommand(payload.NewPayloadCmd())
 	rootCmd.AddCommand(job_analysis.NewAnalysisCmd())
+	rootCmd.AddCommand(job_history.NewJobHistoryCmd())
+	rootCmd.AddCommand(cache.NewCacheCmd())
+	rootCmd.AddCommand(config.NewConfigCmd())
+	rootCmd.AddCommand(serve.NewServeCmd())
 	return rootCmd
 }
+
+// setConfigPath sets the config file from --config, the environment or the default (in that
+// order) and returns true if the user asked for that file (so it has to exist).
+func setConfigPath(cmd *cobra.Command) bool {
+	config.Path = configFile
+	if cmd.Flags().Changed("config") {
+		return true
+	}
+	if path, ok := os.LookupEnv(config.EnvPrefix + "CONFIG"); ok {
+		config.Path = path
+		return true
+	}
+	return false
+}
+
+// applySettings hands the settings to the packages that use them.
+func applySettings() {
+	c := config.Current
+	payload_processing.BODY_TIMEOUT = c.BodyTimeout
+	payload_processing.JUNIT_TIMEOUT = c.JunitTimeout
+	payload_processing.JOB_DETAIL_TIMEOUT = c.JobDetailTimeout
+	payload_processing.MAX_JOBS = c.MaxJobs
+	payload_processing.MAX_TESTS = c.MaxTests
+	payload_processing.MAX_CHAR = c.MaxChar
+	payload_processing.SetColor(terminal.Color)
+}
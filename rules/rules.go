@@ -0,0 +1,154 @@
+// Package rules decides how a test shows up in the analysis output: hidden, reclassified
+// (e.g., as disruption) or annotated with a bug link.  Rules are regexes matched against the
+// test name and come from a YAML file so they can change without changing code.
+package rules
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Class is how a test is (re)classified.
+type Class string
+
+const (
+	ClassNone       Class = ""
+	ClassDisruption Class = "disruption"
+	ClassInfra      Class = "infra"
+	ClassKnownBug   Class = "known-bug"
+)
+
+// expiresLayout is the format of the expires field.
+const expiresLayout = "2006-01-02"
+
+//go:embed default_rules.yaml
+var defaultRulesYaml []byte
+
+// Rule applies to tests whose name matches the Match regex.
+type Rule struct {
+	Match   string `yaml:"match"`
+	Hide    bool   `yaml:"hide"`
+	Class   Class  `yaml:"class"`
+	Bug     string `yaml:"bug"`
+	Expires string `yaml:"expires"`
+
+	re      *regexp.Regexp
+	expires time.Time // zero means it never expires
+}
+
+// RuleSet is the contents of a rules file.
+type RuleSet struct {
+	// IncludeDefaults (true if not set) appends the built-in rules after the ones in the file.
+	IncludeDefaults *bool   `yaml:"includeDefaults"`
+	Rules           []*Rule `yaml:"rules"`
+}
+
+// Verdict is the result of applying the rules to a test name.
+type Verdict struct {
+	Hidden  bool
+	Class   Class
+	Bug     string
+	Expires time.Time
+}
+
+// compile checks the rules and compiles their regexes.
+func (rs *RuleSet) compile() error {
+	for i, r := range rs.Rules {
+		if r.Match == "" {
+			return fmt.Errorf("rule %d has no match", i+1)
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("rule %d has a bad match %q: %w", i+1, r.Match, err)
+		}
+		r.re = re
+		switch r.Class {
+		case ClassNone, ClassDisruption, ClassInfra, ClassKnownBug:
+		default:
+			return fmt.Errorf("rule %d has an unknown class %q (use %s, %s or %s)", i+1, r.Class, ClassDisruption, ClassInfra, ClassKnownBug)
+		}
+		if r.Expires != "" {
+			expires, err := time.Parse(expiresLayout, r.Expires)
+			if err != nil {
+				return fmt.Errorf("rule %d has a bad expires %q (use YYYY-MM-DD): %w", i+1, r.Expires, err)
+			}
+			r.expires = expires
+		}
+	}
+	return nil
+}
+
+// parse decodes and compiles a rules file.
+func parse(data []byte) (*RuleSet, error) {
+	rs := &RuleSet{}
+	if err := yaml.Unmarshal(data, rs); err != nil {
+		return nil, err
+	}
+	if err := rs.compile(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Default returns the built-in rules.
+func Default() *RuleSet {
+	rs, err := parse(defaultRulesYaml)
+	if err != nil {
+		// The built-in rules are part of the binary so this is a programming error.
+		panic(fmt.Sprintf("bad built-in rules: %s", err))
+	}
+	return rs
+}
+
+// Load reads a rules file; if path is empty, the built-in rules are returned.
+func Load(path string) (*RuleSet, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if rs.IncludeDefaults == nil || *rs.IncludeDefaults {
+		rs.Rules = append(rs.Rules, Default().Rules...)
+	}
+	return rs, nil
+}
+
+// Classify applies the rules to a test name.  All matching rules that haven't expired are used;
+// the first one that sets a class (or bug) wins.
+func (rs *RuleSet) Classify(testName string) Verdict {
+	v := Verdict{}
+	if rs == nil {
+		return v
+	}
+	now := time.Now()
+	for _, r := range rs.Rules {
+		if !r.expires.IsZero() && now.After(r.expires.AddDate(0, 0, 1)) {
+			continue
+		}
+		if !r.re.MatchString(testName) {
+			continue
+		}
+		if r.Hide {
+			v.Hidden = true
+		}
+		if v.Class == ClassNone && r.Class != ClassNone {
+			v.Class = r.Class
+		}
+		if v.Bug == "" && r.Bug != "" {
+			v.Bug = r.Bug
+			v.Expires = r.expires
+		}
+	}
+	return v
+}
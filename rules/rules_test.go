@@ -0,0 +1,141 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format(expiresLayout)
+	today := time.Now().UTC().Format(expiresLayout)
+	rs, err := parse([]byte(`
+rules:
+  - match: 'flaky \[sig-foo\]'
+    hide: true
+  - match: '\[sig-network\].*sandboxes'
+    class: known-bug
+    bug: https://issues.redhat.com/browse/OCPBUGS-1
+    expires: ` + tomorrow + `
+  - match: 'sandboxes'
+    class: infra
+    bug: https://issues.redhat.com/browse/OCPBUGS-2
+  - match: 'old bug'
+    class: known-bug
+    bug: https://issues.redhat.com/browse/OCPBUGS-3
+    expires: 2020-01-01
+  - match: 'last day'
+    bug: https://issues.redhat.com/browse/OCPBUGS-4
+    expires: ` + today + `
+  - match: 'disruption'
+    class: disruption
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want Verdict
+	}{
+		{"a test nobody has rules for", Verdict{}},
+		{"flaky [sig-foo] test", Verdict{Hidden: true}},
+		// The first rule that sets a class (or bug) wins.
+		{"[sig-network] pods should successfully create sandboxes by other", Verdict{Class: ClassKnownBug, Bug: "https://issues.redhat.com/browse/OCPBUGS-1"}},
+		{"[sig-node] sandboxes", Verdict{Class: ClassInfra, Bug: "https://issues.redhat.com/browse/OCPBUGS-2"}},
+		// An expired rule no longer applies so the next matching one does.
+		{"old bug disruption", Verdict{Class: ClassDisruption}},
+		// A rule applies until the end of the day it expires.
+		{"last day", Verdict{Bug: "https://issues.redhat.com/browse/OCPBUGS-4"}},
+		{"flaky [sig-foo] disruption", Verdict{Hidden: true, Class: ClassDisruption}},
+	}
+	for _, tt := range tests {
+		got := rs.Classify(tt.name)
+		got.Expires = time.Time{}
+		if got != tt.want {
+			t.Errorf("Classify(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if v := rs.Classify("[sig-network] sandboxes"); v.Expires.Format(expiresLayout) != tomorrow {
+		t.Errorf("expected the bug to expire %s, got %s", tomorrow, v.Expires)
+	}
+	var none *RuleSet
+	if v := none.Classify("anything"); v != (Verdict{}) {
+		t.Errorf("expected no verdict without rules, got %+v", v)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	rs := Default()
+	tests := []struct {
+		name   string
+		hidden bool
+		class  Class
+	}{
+		{"Run multi-stage test e2e-aws-ovn - e2e-aws-ovn-openshift-e2e-test container test", true, ClassNone},
+		{"[sig-network] disruption/ingress-to-oauth-server connection/new should be available throughout the test", false, ClassDisruption},
+		{"[sig-network-edge] Application behind service load balancer with PDB remains available using new connections", false, ClassDisruption},
+		{"[sig-api-machinery][Feature:APIServer][Late] API LBs follow /readyz of kube-apiserver", false, ClassNone},
+	}
+	for _, tt := range tests {
+		if v := rs.Classify(tt.name); v.Hidden != tt.hidden || v.Class != tt.class {
+			t.Errorf("Classify(%q) = %+v, want hidden=%v class=%q", tt.name, v, tt.hidden, tt.class)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want string
+	}{
+		{"rules:\n  - hide: true\n", "rule 1 has no match"},
+		{"rules:\n  - match: 'a'\n  - match: '(unclosed'\n", "rule 2 has a bad match"},
+		{"rules:\n  - match: 'a'\n    class: flaky\n", `unknown class "flaky"`},
+		{"rules:\n  - match: 'a'\n    expires: 01/02/2025\n", "bad expires"},
+		{"rules: [", "yaml"},
+	}
+	for _, tt := range tests {
+		_, err := parse([]byte(tt.yaml))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parse(%q): expected an error with %q, got %v", tt.yaml, tt.want, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	rs, err := Load(write("with.yaml", "rules:\n  - match: 'mine'\n    hide: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rules) != len(Default().Rules)+1 || rs.Rules[0].Match != "mine" {
+		t.Errorf("expected the file's rule followed by the built-in rules, got %d rules", len(rs.Rules))
+	}
+
+	rs, err = Load(write("without.yaml", "includeDefaults: false\nrules:\n  - match: 'mine'\n    hide: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rules) != 1 {
+		t.Errorf("expected only the file's rule, got %d rules", len(rs.Rules))
+	}
+
+	if _, err := Load(write("bad.yaml", "rules:\n  - hide: true\n")); err == nil || !strings.Contains(err.Error(), "bad.yaml") {
+		t.Errorf("expected an error naming the file, got %v", err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,128 @@
+package serve
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dperique/release-analysis/payload_processing"
+)
+
+// releaseStatus is what we found the last time we analyzed a version and stream.
+type releaseStatus struct {
+	version, stream string
+	analyzed        time.Time // zero if it never worked
+	up              bool      // the last analysis worked
+	lastAccepted    time.Time // zero if none of the listed payloads was accepted
+	rejected        int       // rejected payloads in the release controller's list
+	latest          payload_processing.PayloadHealth
+}
+
+// metric is a gauge and its samples in the Prometheus text format.
+type metric struct {
+	name, help string
+	samples    []string
+}
+
+func (m *metric) add(value float64, labels ...string) {
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	m.samples = append(m.samples, fmt.Sprintf("%s{%s} %s", m.name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'g', -1, 64)))
+}
+
+// labelEscaper escapes a label value the way the Prometheus text format wants.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// maxTestSeries is how many of a job's failed tests get their own series; the rest are added
+// up under test="other" so a payload that breaks hundreds of tests doesn't flood Prometheus.
+const maxTestSeries = 20
+
+// topTests returns the tests that failed in the most job runs (at most maxTestSeries, by name
+// when tied) and how many job runs the rest failed in.
+func topTests(failures map[string]int) ([]string, int) {
+	tests := []string{}
+	for test := range failures {
+		tests = append(tests, test)
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		if failures[tests[i]] != failures[tests[j]] {
+			return failures[tests[i]] > failures[tests[j]]
+		}
+		return tests[i] < tests[j]
+	})
+	if len(tests) <= maxTestSeries {
+		return tests, 0
+	}
+	other := 0
+	for _, test := range tests[maxTestSeries:] {
+		other += failures[test]
+	}
+	return tests[:maxTestSeries], other
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeMetrics writes statuses to w in the Prometheus text exposition format; now is used for
+// the time since the last accepted payload.
+func writeMetrics(w io.Writer, statuses []releaseStatus, now time.Time) {
+	up := &metric{name: "release_analysis_up", help: "1 if the last analysis of the version and stream worked"}
+	analyzed := &metric{name: "release_analysis_last_analysis_timestamp_seconds", help: "When the version and stream were last analyzed successfully"}
+	sinceAccepted := &metric{name: "release_analysis_time_since_last_accepted_payload_seconds", help: "Seconds since the newest accepted payload was created"}
+	rejected := &metric{name: "release_analysis_rejected_payloads", help: "Rejected payloads listed by the release controller"}
+	latestPayload := &metric{name: "release_analysis_latest_payload_info", help: "The latest finished payload the job metrics are about (always 1)"}
+	jobPassed := &metric{name: "release_analysis_blocking_job_passed", help: "1 if the blocking job passed on the latest finished payload, 0 if it failed or is pending"}
+	failedTests := &metric{name: "release_analysis_aggregated_failed_tests", help: "Tests that failed in the failed aggregated jobs of the latest finished payload"}
+	testFailures := &metric{name: "release_analysis_aggregated_test_failures", help: "Job runs a test failed in for the failed aggregated jobs of the latest finished payload (past the top " + strconv.Itoa(maxTestSeries) + " tests, added up as test=\"other\")"}
+	disruption := &metric{name: "release_analysis_disruption_seconds", help: "Disruption of the backends that failed in the aggregated jobs of the latest finished payload"}
+
+	for _, s := range statuses {
+		release := []string{"version", s.version, "stream", s.stream}
+		up.add(boolValue(s.up), release...)
+		if s.analyzed.IsZero() {
+			continue
+		}
+		analyzed.add(float64(s.analyzed.Unix()), release...)
+		if !s.lastAccepted.IsZero() {
+			sinceAccepted.add(now.Sub(s.lastAccepted).Seconds(), release...)
+		}
+		rejected.add(float64(s.rejected), release...)
+		if s.latest.Name != "" {
+			latestPayload.add(1, append(release, "payload", s.latest.Name, "phase", s.latest.Phase)...)
+		}
+		for _, job := range s.latest.BlockingJobs {
+			labels := append(release, "job", job.Name)
+			jobPassed.add(boolValue(job.Status == "Succeeded"), labels...)
+
+			if job.TestFailures != nil {
+				failedTests.add(float64(len(job.TestFailures)), labels...)
+			}
+			tests, other := topTests(job.TestFailures)
+			for _, test := range tests {
+				testFailures.add(float64(job.TestFailures[test]), append(labels[:len(labels):len(labels)], "test", test)...)
+			}
+			if other > 0 {
+				testFailures.add(float64(other), append(labels[:len(labels):len(labels)], "test", "other")...)
+			}
+			for _, d := range job.Disruption {
+				disruption.add(d.Seconds, append(labels[:len(labels):len(labels)], "backend", d.Backend, "statistic", d.Statistic)...)
+			}
+		}
+	}
+
+	for _, m := range []*metric{up, analyzed, sinceAccepted, rejected, latestPayload, jobPassed, failedTests, testFailures, disruption} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, sample := range m.samples {
+			fmt.Fprintln(w, sample)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package serve
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dperique/release-analysis/payload_processing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	now := time.Date(2024, 4, 21, 15, 0, 0, 0, time.UTC)
+	manyFailures := map[string]int{}
+	for i := 0; i < maxTestSeries+3; i++ {
+		manyFailures[fmt.Sprintf("test %02d", i)] = 2
+	}
+	manyFailures["worst test"] = 9
+	statuses := []releaseStatus{
+		{
+			version: "4.16", stream: "nightly", up: true,
+			analyzed:     now.Add(-time.Minute),
+			lastAccepted: now.Add(-2 * time.Hour),
+			rejected:     2,
+			latest: payload_processing.PayloadHealth{
+				Name:  "4.16.0-0.nightly-2024-04-21-120000",
+				Phase: "Rejected",
+				BlockingJobs: []payload_processing.BlockingJobHealth{
+					{Name: "gcp-ovn", Status: "Succeeded"},
+					{Name: "aggregated-aws-ovn-upgrade-4.16-micro", Status: "Failed",
+						TestFailures: map[string]int{`[sig-network] "quoted" test`: 3},
+						Disruption:   []payload_processing.Disruption{{Backend: "ingress-to-oauth-server", Statistic: "P95", Seconds: 4.5}},
+					},
+					{Name: "aggregated-gcp-ovn-upgrade-4.16-micro", Status: "Failed", TestFailures: manyFailures},
+				},
+			},
+		},
+		// Never analyzed so only up is reported.
+		{version: "4.17", stream: "ci"},
+	}
+	var out strings.Builder
+	writeMetrics(&out, statuses, now)
+	output := out.String()
+
+	release := `version="4.16",stream="nightly"`
+	for _, want := range []string{
+		"# HELP release_analysis_up 1 if the last analysis of the version and stream worked\n# TYPE release_analysis_up gauge\n",
+		"release_analysis_up{" + release + "} 1\n",
+		`release_analysis_up{version="4.17",stream="ci"} 0` + "\n",
+		"release_analysis_last_analysis_timestamp_seconds{" + release + "} 1.71371154e+09\n",
+		"release_analysis_time_since_last_accepted_payload_seconds{" + release + "} 7200\n",
+		"release_analysis_rejected_payloads{" + release + "} 2\n",
+		"release_analysis_latest_payload_info{" + release + `,payload="4.16.0-0.nightly-2024-04-21-120000",phase="Rejected"} 1` + "\n",
+		"release_analysis_blocking_job_passed{" + release + `,job="gcp-ovn"} 1` + "\n",
+		"release_analysis_blocking_job_passed{" + release + `,job="aggregated-aws-ovn-upgrade-4.16-micro"} 0` + "\n",
+		"release_analysis_aggregated_failed_tests{" + release + `,job="aggregated-aws-ovn-upgrade-4.16-micro"} 1` + "\n",
+		"release_analysis_aggregated_test_failures{" + release + `,job="aggregated-aws-ovn-upgrade-4.16-micro",test="[sig-network] \"quoted\" test"} 3` + "\n",
+		"release_analysis_disruption_seconds{" + release + `,job="aggregated-aws-ovn-upgrade-4.16-micro",backend="ingress-to-oauth-server",statistic="P95"} 4.5` + "\n",
+		// Past the top tests, the failures are added up.
+		"release_analysis_aggregated_failed_tests{" + release + `,job="aggregated-gcp-ovn-upgrade-4.16-micro"} 24` + "\n",
+		"release_analysis_aggregated_test_failures{" + release + `,job="aggregated-gcp-ovn-upgrade-4.16-micro",test="worst test"} 9` + "\n",
+		"release_analysis_aggregated_test_failures{" + release + `,job="aggregated-gcp-ovn-upgrade-4.16-micro",test="test 18"} 2` + "\n",
+		"release_analysis_aggregated_test_failures{" + release + `,job="aggregated-gcp-ovn-upgrade-4.16-micro",test="other"} 8` + "\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in:\n%s", want, output)
+		}
+	}
+	for _, notWant := range []string{
+		`version="4.17",stream="ci"} 0` + "\nrelease_analysis_last",
+		`test="test 19"`,
+		`job="gcp-ovn",test=`,
+		`release_analysis_aggregated_failed_tests{` + release + `,job="gcp-ovn"}`,
+	} {
+		if strings.Contains(output, notWant) {
+			t.Errorf("didn't expect %q in:\n%s", notWant, output)
+		}
+	}
+	if n := strings.Count(output, "release_analysis_aggregated_test_failures{"+release+`,job="aggregated-gcp-ovn-upgrade-4.16-micro"`); n != maxTestSeries+1 {
+		t.Errorf("expected %d test series for the job with many failures, got %d", maxTestSeries+1, n)
+	}
+}
@@ -0,0 +1,166 @@
+// Package serve is the metrics exporter: it analyzes the configured releases (version/stream
+// pairs) on a schedule and serves what it found as Prometheus metrics so payload health can go on
+// dashboards and be alerted on.
+package serve
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dperique/release-analysis/config"
+	"github.com/dperique/release-analysis/logging"
+	"github.com/dperique/release-analysis/payload_processing"
+	"github.com/spf13/cobra"
+)
+
+type serveOptsType struct {
+	metricsAddr string
+	interval    time.Duration
+	once        bool
+}
+
+var serveOpts serveOptsType
+
+// Create the serve command
+var ServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Analyze the releases on a schedule and serve Prometheus metrics about their payloads",
+	Long:  `Analyze the releases (--releases or the releases setting, e.g., 4.16/nightly,4.17/ci) every --interval and serve metrics at http://<--metrics>/metrics`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := serveOpts.Run(); err != nil {
+			slog.Error("unable to serve metrics", "err", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func NewServeCmd() *cobra.Command {
+	ServeCmd.Flags().StringVar(&serveOpts.metricsAddr, "metrics", ":9090", "Address to serve the metrics on (at /metrics)")
+	ServeCmd.Flags().DurationVar(&serveOpts.interval, "interval", 15*time.Minute, "How often to analyze the releases")
+	ServeCmd.Flags().BoolVar(&serveOpts.once, "once", false, "Analyze the releases once, print the metrics and exit")
+	ServeCmd.Flags().AddFlag(config.Flag("releases"))
+	return ServeCmd
+}
+
+// parseReleases parses version/stream pairs like 4.16/nightly,4.17/ci; empty means the version
+// and stream settings.
+func parseReleases(releases string) ([]releaseStatus, error) {
+	if strings.TrimSpace(releases) == "" {
+		releases = config.Current.Version + "/" + config.Current.Stream
+	}
+	statuses := []releaseStatus{}
+	for _, release := range strings.Split(releases, ",") {
+		version, stream, found := strings.Cut(strings.TrimSpace(release), "/")
+		if !found || version == "" || (stream != "nightly" && stream != "ci") {
+			return nil, fmt.Errorf("bad release %q (use version/stream, e.g., 4.16/nightly)", release)
+		}
+		statuses = append(statuses, releaseStatus{version: version, stream: stream})
+	}
+	return statuses, nil
+}
+
+// readHeaderTimeout is how long a scraper gets to send its request headers.
+const readHeaderTimeout = 10 * time.Second
+
+// Run analyzes the releases and serves the metrics until the server fails (or, with --once,
+// prints them and returns).
+func (o *serveOptsType) Run() error {
+	statuses, err := parseReleases(config.Current.Releases)
+	if err != nil {
+		return err
+	}
+	getter, known := payload_processing.NewPayloadGetter(config.Current.DbMode)
+	if !known {
+		slog.Warn("unknown dbMode; defaulting to rcWebpage", "dbMode", config.Current.DbMode)
+	}
+
+	var mu sync.Mutex
+	analyzeAll := func() {
+		for i := range statuses {
+			mu.Lock()
+			previous := statuses[i]
+			mu.Unlock()
+			status := analyze(getter, previous)
+			mu.Lock()
+			statuses[i] = status
+			mu.Unlock()
+		}
+	}
+
+	if o.once {
+		analyzeAll()
+		writeMetrics(os.Stdout, statuses, time.Now())
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		current := append([]releaseStatus{}, statuses...)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, current, time.Now())
+	})
+	go func() {
+		for {
+			analyzeAll()
+			time.Sleep(o.interval)
+		}
+	}()
+
+	slog.Info("serving metrics", "addr", o.metricsAddr, "interval", o.interval)
+	server := &http.Server{Addr: o.metricsAddr, Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
+	if err := server.ListenAndServe(); err != nil {
+		return fmt.Errorf("serving on %s: %w", o.metricsAddr, err)
+	}
+	return nil
+}
+
+// analyze lists the payloads of a release and scrapes the latest finished one.  If the payloads
+// can't be listed, the previous status is kept (and marked down) so the metrics don't vanish.
+func analyze(getter payload_processing.PayloadGetter, previous releaseStatus) releaseStatus {
+	start := time.Now()
+	payloads, err := payload_processing.GetPayloadItems(previous.version, previous.stream, getter)
+	if err != nil {
+		slog.Warn("unable to list payloads", "version", previous.version, "stream", previous.stream, "err", err)
+		previous.up = false
+		return previous
+	}
+
+	status := releaseStatus{version: previous.version, stream: previous.stream, analyzed: start, up: true}
+	var latest payload_processing.ReleasePayload
+	var latestTime time.Time
+	for _, p := range payloads {
+		t, ok := p.Time()
+		switch p.Phase() {
+		case "Accepted":
+			if ok && t.After(status.lastAccepted) {
+				status.lastAccepted = t
+			}
+		case "Rejected":
+			status.rejected++
+		default:
+			// Still running so it says nothing about the jobs yet.
+			continue
+		}
+		if latest.ReleaseURL == "" || ok && t.After(latestTime) {
+			latest, latestTime = p, t
+		}
+	}
+
+	if latest.ReleaseURL != "" {
+		status.latest, err = payload_processing.GetPayloadHealth(latest)
+		if err != nil {
+			slog.Warn("unable to analyze the latest payload", "payload", latest.Name(), "err", err)
+			status.up = false
+		}
+	}
+	slog.Info("analyzed release", "version", status.version, "stream", status.stream, "payloads", len(payloads), "latest", status.latest.Name, logging.Elapsed(start))
+	return status
+}
@@ -0,0 +1,40 @@
+package serve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dperique/release-analysis/config"
+)
+
+func TestParseReleases(t *testing.T) {
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+	config.Current.Version, config.Current.Stream = "4.15", "ci"
+
+	tests := []struct {
+		releases string
+		want     []releaseStatus
+		wantErr  bool
+	}{
+		{"4.16/nightly", []releaseStatus{{version: "4.16", stream: "nightly"}}, false},
+		{" 4.16/nightly , 4.17/ci ", []releaseStatus{{version: "4.16", stream: "nightly"}, {version: "4.17", stream: "ci"}}, false},
+		// Empty means the version and stream settings.
+		{"", []releaseStatus{{version: "4.15", stream: "ci"}}, false},
+		{"  ", []releaseStatus{{version: "4.15", stream: "ci"}}, false},
+		{"4.16", nil, true},
+		{"/nightly", nil, true},
+		{"4.16/okd", nil, true},
+		{"4.16/nightly,", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseReleases(tt.releases)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseReleases(%q): unexpected error %v", tt.releases, err)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseReleases(%q) = %+v, want %+v", tt.releases, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package terminal
+
+import "os"
+
+// size returns the width of f (unknown here, so 0) and true if it's a terminal.
+func size(f *os.File) (int, bool) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false
+	}
+	return 0, info.Mode()&os.ModeCharDevice != 0
+}
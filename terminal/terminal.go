@@ -0,0 +1,104 @@
+// Package terminal decides how the output is rendered: colors, hyperlinks and the width to wrap
+// to depend on whether stdout is a terminal, --color and NO_COLOR.
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultWidth is used for separators when we don't know the width (e.g., output is piped).
+const DefaultWidth = 176
+
+var (
+	// Color is true if the output should have colors.
+	Color = true
+
+	// Hyperlinks is true if urls should be OSC 8 hyperlinks on the text they're for instead of
+	// being printed.
+	Hyperlinks = false
+
+	// Width is the number of columns to wrap to (0 means don't wrap).
+	Width = 0
+)
+
+// escapeRegex matches the color (SGR) and hyperlink (OSC 8) escape sequences we emit.
+var escapeRegex = regexp.MustCompile("\x1b\\[[0-9;]*m|\x1b]8;;[^\x1b]*\x1b\\\\")
+
+// Setup sets Color, Hyperlinks and Width for stdout given mode (auto, always or never).  In auto
+// mode, colors and hyperlinks are only used on a terminal, and colors not at all if NO_COLOR is
+// set (see https://no-color.org).  COLUMNS overrides the terminal's width.
+func Setup(mode string) error {
+	width, isTerminal := size(os.Stdout)
+	return setup(mode, width, isTerminal)
+}
+
+// setup does the work for Setup given stdout's width and whether it's a terminal.
+func setup(mode string, width int, isTerminal bool) error {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		width = columns
+	}
+	switch mode {
+	case "always":
+		Color, Hyperlinks = true, true
+	case "never":
+		Color, Hyperlinks = false, false
+	case "auto", "":
+		Color = isTerminal && os.Getenv("NO_COLOR") == ""
+		Hyperlinks = isTerminal && os.Getenv("TERM") != "dumb"
+	default:
+		return fmt.Errorf("bad color %q (use auto, always or never)", mode)
+	}
+	Width = width
+	return nil
+}
+
+// Link returns text as a hyperlink to url (just text if hyperlinks are off).
+func Link(url, text string) string {
+	if !Hyperlinks || url == "" {
+		return text
+	}
+	return "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+// Separator returns a line of '=' as wide as the terminal.
+func Separator() string {
+	if Width == 0 {
+		return strings.Repeat("=", DefaultWidth)
+	}
+	return strings.Repeat("=", Width)
+}
+
+// VisibleLen returns how many columns s takes (escape sequences take none).
+func VisibleLen(s string) int {
+	return utf8.RuneCountInString(escapeRegex.ReplaceAllString(s, ""))
+}
+
+// Wrap breaks line (without its newline) at spaces so each piece fits in Width; the pieces after
+// the first start with indent.  A word longer than Width is left as is.
+func Wrap(line, indent string) string {
+	if Width == 0 || VisibleLen(line) <= Width {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for i, word := range strings.Split(line, " ") {
+		wordLen := VisibleLen(word)
+		switch {
+		case i == 0:
+		case column+1+wordLen > Width && column > len(indent):
+			b.WriteString("\n" + indent)
+			column = len(indent)
+		default:
+			b.WriteString(" ")
+			column++
+		}
+		b.WriteString(word)
+		column += wordLen
+	}
+	return b.String()
+}
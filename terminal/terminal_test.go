@@ -0,0 +1,124 @@
+package terminal
+
+import (
+	"strings"
+	"testing"
+)
+
+// saveSettings puts Color, Hyperlinks and Width back when the test is done.
+func saveSettings(t *testing.T) {
+	color, hyperlinks, width := Color, Hyperlinks, Width
+	t.Cleanup(func() { Color, Hyperlinks, Width = color, hyperlinks, width })
+}
+
+func TestSetup(t *testing.T) {
+	saveSettings(t)
+	tests := []struct {
+		name           string
+		mode           string
+		width          int
+		isTerminal     bool
+		env            map[string]string
+		wantColor      bool
+		wantHyperlinks bool
+		wantWidth      int
+	}{
+		{"terminal", "auto", 120, true, nil, true, true, 120},
+		{"default mode", "", 120, true, nil, true, true, 120},
+		{"piped", "auto", 0, false, nil, false, false, 0},
+		{"NO_COLOR", "auto", 120, true, map[string]string{"NO_COLOR": "1"}, false, true, 120},
+		{"dumb terminal", "auto", 120, true, map[string]string{"TERM": "dumb"}, true, false, 120},
+		{"COLUMNS", "auto", 120, true, map[string]string{"COLUMNS": "80"}, true, true, 80},
+		{"piped with COLUMNS", "auto", 0, false, map[string]string{"COLUMNS": "80"}, false, false, 80},
+		{"bad COLUMNS", "auto", 120, true, map[string]string{"COLUMNS": "wide"}, true, true, 120},
+		{"always", "always", 0, false, map[string]string{"NO_COLOR": "1"}, true, true, 0},
+		{"never", "never", 120, true, nil, false, false, 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"NO_COLOR", "TERM", "COLUMNS"} {
+				t.Setenv(name, tt.env[name])
+			}
+			if err := setup(tt.mode, tt.width, tt.isTerminal); err != nil {
+				t.Fatal(err)
+			}
+			if Color != tt.wantColor || Hyperlinks != tt.wantHyperlinks || Width != tt.wantWidth {
+				t.Errorf("got color=%v hyperlinks=%v width=%d, want color=%v hyperlinks=%v width=%d",
+					Color, Hyperlinks, Width, tt.wantColor, tt.wantHyperlinks, tt.wantWidth)
+			}
+		})
+	}
+
+	if err := setup("sometimes", 0, false); err == nil || !strings.Contains(err.Error(), `bad color "sometimes"`) {
+		t.Errorf("expected a bad color error, got %v", err)
+	}
+}
+
+func TestVisibleLen(t *testing.T) {
+	saveSettings(t)
+	Hyperlinks = true
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"plain text", 10},
+		{"\x1b[1;31mFailed:\x1b[0m", 7},
+		{Link("https://prow.ci.openshift.org/view/gs/test-platform-results/logs/job/1", "job/1"), 5},
+		{"pass=0/fail=10 ✓", 16},
+	}
+	for _, tt := range tests {
+		if got := VisibleLen(tt.s); got != tt.want {
+			t.Errorf("VisibleLen(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	saveSettings(t)
+	Hyperlinks = true
+	link := Link("https://sippy.dptools.openshift.org/sippy-ng/tests/4.16/analysis?test=x", "[sig-network] pods")
+	tests := []struct {
+		width int
+		line  string
+		want  string
+	}{
+		{0, "    Failed: a line that is not wrapped when the width is unknown", "    Failed: a line that is not wrapped when the width is unknown"},
+		{40, "    Failed: short enough", "    Failed: short enough"},
+		{30, "    Failed: [sig-network] pods should successfully create sandboxes", "    Failed: [sig-network] pods\n      should successfully\n      create sandboxes"},
+		// A word longer than the width is left as is.
+		{20, "    Failed: averyveryveryverylongword end", "    Failed:\n      averyveryveryverylongword\n      end"},
+		// Escape sequences don't count toward the width.
+		{30, "    \x1b[31mFailed: " + link + " should work\x1b[0m", "    \x1b[31mFailed: " + link + "\n      should work\x1b[0m"},
+	}
+	for _, tt := range tests {
+		Width = tt.width
+		if got := Wrap(tt.line, "      "); got != tt.want {
+			t.Errorf("Wrap(%q) at %d:\ngot  %q\nwant %q", tt.line, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestLinkAndSeparator(t *testing.T) {
+	saveSettings(t)
+	Hyperlinks = false
+	if got := Link("https://example.com", "text"); got != "text" {
+		t.Errorf("expected just the text without hyperlinks, got %q", got)
+	}
+	Hyperlinks = true
+	if got := Link("https://example.com", "text"); got != "\x1b]8;;https://example.com\x1b\\text\x1b]8;;\x1b\\" {
+		t.Errorf("unexpected hyperlink %q", got)
+	}
+	if got := Link("", "text"); got != "text" {
+		t.Errorf("expected just the text without a url, got %q", got)
+	}
+
+	Width = 0
+	if got := Separator(); got != strings.Repeat("=", DefaultWidth) {
+		t.Errorf("expected a separator of %d, got %d", DefaultWidth, len(got))
+	}
+	Width = 40
+	if got := Separator(); got != strings.Repeat("=", 40) {
+		t.Errorf("expected a separator of 40, got %d", len(got))
+	}
+}